@@ -11,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/time/rate"
 )
 
@@ -36,8 +37,16 @@ func NewAEMO() *AEMO {
 	return a
 }
 
+// Counts the failure against its cause and passes the error on.
+func aemoFetchFailed(cause string, err error) (AEMOData, error) {
+	aemoFetchErrors.WithLabelValues(cause).Inc()
+	return AEMOData{}, err
+}
+
 func (aemo *AEMO) GetAEMOData(HostUrl string) (AEMOData, error) {
 	// Fetch AEMO data from the AEMO API
+	timer := prometheus.NewTimer(aemoFetchDuration)
+	defer timer.ObserveDuration()
 
 	// Send a POST request to AEMO_URL with AEMO_POST_PAYLOAD
 	if HostUrl == "" {
@@ -53,40 +62,42 @@ func (aemo *AEMO) GetAEMOData(HostUrl string) (AEMOData, error) {
 	POSTResp, err := aemo.client.Do(POSTReq)
 
 	if err != nil {
-		return AEMOData{}, err
+		return aemoFetchFailed(AEMO_FETCH_ERROR_REQUEST, err)
 	}
+	defer POSTResp.Body.Close()
 
 	// Check the response status code
 	if POSTResp.StatusCode != 200 {
-		return AEMOData{}, fmt.Errorf("got status code %d", POSTResp.StatusCode)
+		return aemoFetchFailed(AEMO_FETCH_ERROR_STATUS, fmt.Errorf("got status code %d", POSTResp.StatusCode))
 	}
 	// Read the response body
 	RESPBody, err := io.ReadAll(POSTResp.Body)
 	if err != nil {
-		return AEMOData{}, err
+		return aemoFetchFailed(AEMO_FETCH_ERROR_READ, err)
 	}
 
 	// If the response is gzipped, decompress it
 	if POSTResp.Header.Get("Content-Encoding") == "gzip" {
 		var r io.Reader
 		if r, err = gzip.NewReader(bytes.NewReader(RESPBody)); err != nil {
-			return AEMOData{}, err
+			return aemoFetchFailed(AEMO_FETCH_ERROR_READ, err)
 		}
 		if RESPBody, err = io.ReadAll(r); err != nil {
-			return AEMOData{}, err
+			return aemoFetchFailed(AEMO_FETCH_ERROR_READ, err)
 		}
 	}
 
 	// Parse the data into an AEMOData structure
 	var decoded AEMOData
 	if err = json.Unmarshal(RESPBody, &decoded); err != nil {
-		return AEMOData{}, err
+		return aemoFetchFailed(AEMO_FETCH_ERROR_DECODE, err)
 	}
 
 	// Validate the parsed data
 	for _, interval := range decoded.Intervals {
 		if err = interval.Validate(); err != nil {
-			return AEMOData{}, err
+			intervalValidationFailures.Inc()
+			return aemoFetchFailed(AEMO_FETCH_ERROR_VALIDATION, err)
 		}
 	}
 
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// API serves what each GridBot currently knows over HTTP:
+//
+//	/regions                   A summary of every region.
+//	/regions/{id}/forecast     The forecast intervals used for the last peak check.
+//	/regions/{id}/peak         The forecast peak and the last peak we tooted about.
+//	/regions/{id}/plot.png     The same plot that gets attached to toots.
+//	/regions/plot.png          Every region's prices on one plot.
+//
+// The plots can be had as plot.svg or plot.pdf too, and in the other colour
+// theme with ?theme=light or ?theme=dark. The plot of every region covers all of
+// them, not just the ones with a GridBot, from the intervals given to SetIntervals.
+type API struct {
+	gridBots gridBotMap
+
+	mu        sync.RWMutex
+	intervals []Interval // The latest intervals from AEMO, for every region.
+}
+
+func NewAPI(gridBots gridBotMap) *API {
+	return &API{gridBots: gridBots}
+}
+
+type apiWindow struct {
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	PeakRRP    float64   `json:"peak_rrp"`
+	PeakTime   time.Time `json:"peak_time"`
+	AverageRRP float64   `json:"average_rrp"`
+}
+
+type apiPeak struct {
+	RegionID           RegionID    `json:"region_id"`
+	Region             string      `json:"region"`
+	PeakRRP            float64     `json:"peak_rrp"`
+	PeakTime           time.Time   `json:"peak_time"`
+	Windows            []apiWindow `json:"windows"`
+	LastTootedPeakRRP  float64     `json:"last_tooted_peak_rrp"`
+	LastTootedPeakTime time.Time   `json:"last_tooted_peak_time"`
+	UpdatedAt          time.Time   `json:"updated_at"`
+}
+
+func newAPIPeak(s GridBotStatus) apiPeak {
+	p := apiPeak{
+		RegionID:           s.RegionID,
+		Region:             s.Region,
+		PeakRRP:            s.PeakRRP,
+		PeakTime:           s.PeakTime,
+		Windows:            []apiWindow{},
+		LastTootedPeakRRP:  s.LastTootedPeakRRP,
+		LastTootedPeakTime: s.LastTootedPeakTime,
+		UpdatedAt:          s.UpdatedAt,
+	}
+	for _, w := range s.PeakWindows {
+		p.Windows = append(p.Windows, apiWindow{
+			Start:      w.Start,
+			End:        w.End,
+			PeakRRP:    w.RRP,
+			PeakTime:   w.RRPTime,
+			AverageRRP: w.AverageRRP,
+		})
+	}
+	return p
+}
+
+type apiForecast struct {
+	RegionID  RegionID       `json:"region_id"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	Intervals []IntervalJSON `json:"intervals"`
+}
+
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "regions" || len(parts) > 3 {
+		http.NotFound(w, r)
+		return
+	}
+	if len(parts) == 1 {
+		a.serveRegions(w)
+		return
+	}
+	if format, ok := plotFormat(parts[1]); ok && len(parts) == 2 {
+		a.serveRegionsPlot(w, r, format)
+		return
+	}
+
+	gb, ok := a.gridBots[RegionID(strings.ToUpper(parts[1]))]
+	if !ok {
+		http.Error(w, "unknown region", http.StatusNotFound)
+		return
+	}
+	status := gb.Status()
+	if len(parts) == 2 {
+		writeJSON(w, newAPIPeak(status))
+		return
+	}
+	switch parts[2] {
+	case "forecast":
+		forecast := apiForecast{
+			RegionID:  status.RegionID,
+			UpdatedAt: status.UpdatedAt,
+			Intervals: []IntervalJSON{},
+		}
+		for _, i := range status.Forecasts {
+			forecast.Intervals = append(forecast.Intervals, NewIntervalJSON(i))
+		}
+		writeJSON(w, forecast)
+	case "peak":
+		writeJSON(w, newAPIPeak(status))
+	default:
+		if format, ok := plotFormat(parts[2]); ok {
+			a.servePlot(w, r, format, gb, status)
+		} else {
+			http.NotFound(w, r)
+		}
+	}
+}
+
+func (a *API) serveRegions(w http.ResponseWriter) {
+	regions := []apiPeak{}
+	for _, gb := range a.gridBots {
+		regions = append(regions, newAPIPeak(gb.Status()))
+	}
+	sort.Slice(regions, func(i, j int) bool {
+		return regions[i].RegionID < regions[j].RegionID
+	})
+	writeJSON(w, regions)
+}
+
+// Returns the format of a plot from its file name, like plot.svg. ok is false
+// if it isn't one.
+func plotFormat(name string) (format string, ok bool) {
+	format, ok = strings.CutPrefix(name, "plot.")
+	if _, known := plotContentTypes[format]; !ok || !known {
+		return "", false
+	}
+	return format, true
+}
+
+// Draws a plot with draw, in the format and theme asked for, and serves it.
+// The theme defaults to the one given.
+func writePlot(w http.ResponseWriter, r *http.Request, options PlotOptions, draw func(PlotOptions, io.Writer) error) {
+	format := options.Format
+	if t := r.URL.Query().Get("theme"); t != "" {
+		options.Theme = t
+	}
+	if err := options.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	buffer := new(bytes.Buffer)
+	if err := draw(options, buffer); err != nil {
+		slog.Error("Failed to plot", "path", r.URL.Path, "err", err)
+		http.Error(w, "failed to plot", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", plotContentTypes[format])
+	w.Write(buffer.Bytes())
+}
+
+func (a *API) servePlot(w http.ResponseWriter, r *http.Request, format string, gb *GridBot, status GridBotStatus) {
+	if len(status.Forecasts) == 0 {
+		http.Error(w, "no forecast yet", http.StatusServiceUnavailable)
+		return
+	}
+	pp := gb.pricePlot(status.Forecasts, status.Actuals, status.PeakWindows, time.Now())
+	writePlot(w, r, PlotOptions{Format: format, Theme: gb.cfg.PlotTheme, Units: gb.cfg.Templates.Units}, func(options PlotOptions, writer io.Writer) error {
+		return PlotPrices(pp, options, writer)
+	})
+}
+
+// Replaces the intervals the plot of every region is drawn from.
+func (a *API) SetIntervals(intervals []Interval) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.intervals = intervals
+}
+
+func (a *API) serveRegionsPlot(w http.ResponseWriter, r *http.Request, format string) {
+	a.mu.RLock()
+	intervals := a.intervals
+	a.mu.RUnlock()
+	if len(intervals) == 0 {
+		http.Error(w, "no forecast yet", http.StatusServiceUnavailable)
+		return
+	}
+	writePlot(w, r, PlotOptions{Format: format}, func(options PlotOptions, writer io.Writer) error {
+		return PlotRegions(intervals, options, writer)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to write response", "err", err)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newAPITestServer(t *testing.T) (*httptest.Server, *API, *GridBot) {
+	gridBots := make(gridBotMap)
+	for _, regionID := range []RegionID{"QLD1", "NSW1"} {
+		gb, err := NewGridBot(GridBotCfg{RegionID: regionID, TestMode: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		gridBots[regionID] = gb
+	}
+	api := NewAPI(gridBots)
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+	return server, api, gridBots["QLD1"]
+}
+
+func apiGet(t *testing.T, url string, wantStatus int, v any) *http.Response {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if want, got := wantStatus, resp.StatusCode; want != got {
+		t.Fatalf("Expected %d, got %d for %s", want, got, url)
+	}
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp
+}
+
+func TestAPI(t *testing.T) {
+	server, api, gb := newAPITestServer(t)
+
+	// Nothing has come in yet.
+	apiGet(t, server.URL+"/regions/QLD1/plot.png", http.StatusServiceUnavailable, nil)
+	apiGet(t, server.URL+"/regions/plot.png", http.StatusServiceUnavailable, nil)
+
+	peakTime := time.Now().Add(2 * time.Hour).Truncate(time.Minute)
+	gb.processInterval(NewForecastInterval(gb, 100, peakTime.Add(-30*time.Minute), t))
+	gb.processInterval(NewForecastInterval(gb, 900, peakTime, t))
+	gb.processInterval(NewForecastInterval(gb, 200, peakTime.Add(30*time.Minute), t))
+	gb.updateStatus()
+
+	var regions []apiPeak
+	apiGet(t, server.URL+"/regions", http.StatusOK, &regions)
+	if want, got := 2, len(regions); want != got {
+		t.Fatalf("Expected %d, got %d", want, got)
+	}
+	if want, got := RegionID("NSW1"), regions[0].RegionID; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if want, got := "Queensland", regions[1].Region; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	var peak apiPeak
+	apiGet(t, server.URL+"/regions/qld1/peak", http.StatusOK, &peak)
+	if want, got := 900.0, peak.PeakRRP; !FloatEquals(want, got) {
+		t.Errorf("Expected %f, got %f", want, got)
+	}
+	if !peak.PeakTime.Equal(peakTime) {
+		t.Errorf("Expected %s, got %s", peakTime, peak.PeakTime)
+	}
+	if peak.UpdatedAt.IsZero() {
+		t.Errorf("Expected updated_at to be set")
+	}
+	if want, got := 1, len(peak.Windows); want != got {
+		t.Fatalf("Expected %d, got %d", want, got)
+	}
+	if !peak.Windows[0].Start.Equal(peakTime.Add(-FORECAST_INTERVAL_LENGTH)) || !peak.Windows[0].End.Equal(peakTime) {
+		t.Errorf("Expected the window to be the half hour to %s, got %+v", peakTime, peak.Windows[0])
+	}
+
+	var forecast apiForecast
+	apiGet(t, server.URL+"/regions/QLD1/forecast", http.StatusOK, &forecast)
+	if want, got := 3, len(forecast.Intervals); want != got {
+		t.Fatalf("Expected %d, got %d", want, got)
+	}
+	if want, got := 200.0, forecast.Intervals[2].RRP; !FloatEquals(want, got) {
+		t.Errorf("Expected %f, got %f", want, got)
+	}
+
+	resp := apiGet(t, server.URL+"/regions/QLD1/plot.png", http.StatusOK, nil)
+	if want, got := "image/png", resp.Header.Get("Content-Type"); want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	// The plot of every region is drawn from all of AEMO's intervals, not just
+	// the ones for regions with a GridBot.
+	apiGet(t, server.URL+"/regions/plot.png", http.StatusServiceUnavailable, nil)
+	intervals := []Interval{}
+	for _, regionID := range []RegionID{"NSW1", "QLD1", "SA1", "TAS1", "VIC1"} {
+		intervals = append(intervals, NewForecastRun(regionID, peakTime, 100, 200, 150)...)
+	}
+	api.SetIntervals(intervals)
+	resp = apiGet(t, server.URL+"/regions/plot.png", http.StatusOK, nil)
+	if want, got := "image/png", resp.Header.Get("Content-Type"); want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	resp, err := http.Get(server.URL + "/regions/plot.svg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svg, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, region := range []string{"Queensland", "Tasmania", "Victoria"} {
+		if !strings.Contains(string(svg), region) {
+			t.Errorf("Expected %s on the plot of every region", region)
+		}
+	}
+
+	resp = apiGet(t, server.URL+"/regions/QLD1/plot.svg?theme=dark", http.StatusOK, nil)
+	if want, got := "image/svg+xml", resp.Header.Get("Content-Type"); want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	resp = apiGet(t, server.URL+"/regions/plot.pdf", http.StatusOK, nil)
+	if want, got := "application/pdf", resp.Header.Get("Content-Type"); want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	apiGet(t, server.URL+"/regions/QLD1/plot.png?theme=sepia", http.StatusBadRequest, nil)
+	apiGet(t, server.URL+"/regions/QLD1/plot.gif", http.StatusNotFound, nil)
+
+	apiGet(t, server.URL+"/regions/WA1/peak", http.StatusNotFound, nil)
+	apiGet(t, server.URL+"/regions/QLD1/nope", http.StatusNotFound, nil)
+	apiGet(t, server.URL+"/nope", http.StatusNotFound, nil)
+
+	resp, err = http.Post(server.URL+"/regions", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if want, got := http.StatusMethodNotAllowed, resp.StatusCode; want != got {
+		t.Errorf("Expected %d, got %d", want, got)
+	}
+}
+
+// The status only changes once a batch of intervals is finished with, so a
+// half-processed batch is never served.
+func TestAPIStatusOnlyUpdatesAfterBatch(t *testing.T) {
+	server, _, gb := newAPITestServer(t)
+
+	gb.processInterval(NewForecastInterval(gb, 900, time.Now().Add(1*time.Hour), t))
+	var peak apiPeak
+	apiGet(t, server.URL+"/regions/QLD1/peak", http.StatusOK, &peak)
+	if !peak.UpdatedAt.IsZero() {
+		t.Errorf("Expected no status before the batch is finished, got %+v", peak)
+	}
+
+	gb.updateStatus()
+	gb.resetIntervalChannel()
+	// An empty batch shouldn't clobber the last good one.
+	gb.updateStatus()
+	apiGet(t, server.URL+"/regions/QLD1/peak", http.StatusOK, &peak)
+	if want, got := 900.0, peak.PeakRRP; !FloatEquals(want, got) {
+		t.Errorf("Expected %f, got %f", want, got)
+	}
+}
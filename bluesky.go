@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+const BLUESKY_DEFAULT_PDS = "https://bsky.social"
+
+var linkRegexp = regexp.MustCompile(`https?://\S+`)
+
+// Returned by a call when the session's access token has expired, which it does
+// every couple of hours.
+var errBlueskyExpiredToken = errors.New("expired token")
+
+// Bluesky posts to a Bluesky account using an app password.
+type Bluesky struct {
+	pdsURL      string
+	handle      string
+	appPassword string
+	client      *http.Client
+
+	// These are filled in when we create a session.
+	accessJwt  string
+	refreshJwt string
+	did        string
+}
+
+func NewBluesky(pdsURL, handle, appPassword string) *Bluesky {
+	if pdsURL == "" {
+		pdsURL = BLUESKY_DEFAULT_PDS
+	}
+	return &Bluesky{
+		pdsURL:      pdsURL,
+		handle:      handle,
+		appPassword: appPassword,
+		client:      &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (b *Bluesky) Name() string {
+	return "bluesky"
+}
+
+type blueskyError struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+type blueskySession struct {
+	AccessJwt  string `json:"accessJwt"`
+	RefreshJwt string `json:"refreshJwt"`
+	Did        string `json:"did"`
+}
+
+// Calls an XRPC procedure on the PDS. body is sent as-is if it's an io.Reader,
+// left out if it's nil, and otherwise encoded as JSON. The response is decoded
+// into out.
+func (b *Bluesky) call(method string, contentType string, body any, out any) error {
+	var reader io.Reader
+	if r, ok := body.(io.Reader); ok {
+		reader = r
+	} else if body != nil {
+		buf, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(buf)
+		contentType = "application/json"
+	}
+	req, err := http.NewRequest("POST", b.pdsURL+"/xrpc/"+method, reader)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if b.accessJwt != "" {
+		req.Header.Set("Authorization", "Bearer "+b.accessJwt)
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e blueskyError
+		json.NewDecoder(resp.Body).Decode(&e)
+		if e.Error == "ExpiredToken" {
+			return fmt.Errorf("%s: %w", method, errBlueskyExpiredToken)
+		}
+		return fmt.Errorf("%s got status code %d: %s %s", method, resp.StatusCode, e.Error, e.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Logs in with the app password if we don't already have a session.
+func (b *Bluesky) connect() error {
+	if b.accessJwt != "" {
+		return nil
+	}
+	var session blueskySession
+	err := b.call("com.atproto.server.createSession", "", map[string]string{
+		"identifier": b.handle,
+		"password":   b.appPassword,
+	}, &session)
+	if err != nil {
+		return fmt.Errorf("failed to connect to bluesky: %s", err)
+	}
+	b.setSession(session)
+	return nil
+}
+
+func (b *Bluesky) setSession(session blueskySession) {
+	b.accessJwt = session.AccessJwt
+	b.refreshJwt = session.RefreshJwt
+	b.did = session.Did
+}
+
+// Swaps the session's refresh token for a new access token, or logs in again if
+// that's expired too.
+func (b *Bluesky) refresh() error {
+	// refreshSession is authorised with the refresh token rather than the access one.
+	b.accessJwt = b.refreshJwt
+	var session blueskySession
+	if err := b.call("com.atproto.server.refreshSession", "", nil, &session); err != nil {
+		b.accessJwt = ""
+		return b.connect()
+	}
+	b.setSession(session)
+	return nil
+}
+
+// Runs f with a session. If the session's expired it's refreshed and f is tried
+// once more, so a post after a quiet spell isn't lost. If f still fails the
+// session is dropped, so the next request logs in again.
+func (b *Bluesky) withSession(f func() error) error {
+	if err := b.connect(); err != nil {
+		return err
+	}
+	err := f()
+	if errors.Is(err, errBlueskyExpiredToken) {
+		if err = b.refresh(); err == nil {
+			err = f()
+		}
+	}
+	if err != nil {
+		b.accessJwt = ""
+	}
+	return err
+}
+
+type blueskyFacet struct {
+	Index struct {
+		ByteStart int `json:"byteStart"`
+		ByteEnd   int `json:"byteEnd"`
+	} `json:"index"`
+	Features []map[string]string `json:"features"`
+}
+
+// Bluesky doesn't find links in the text itself, each one has to be marked up
+// with a facet giving its position in bytes.
+func blueskyLinkFacets(text string) []blueskyFacet {
+	facets := []blueskyFacet{}
+	for _, loc := range linkRegexp.FindAllStringIndex(text, -1) {
+		var f blueskyFacet
+		f.Index.ByteStart = loc[0]
+		f.Index.ByteEnd = loc[1]
+		f.Features = []map[string]string{{
+			"$type": "app.bsky.richtext.facet#link",
+			"uri":   text[loc[0]:loc[1]],
+		}}
+		facets = append(facets, f)
+	}
+	return facets
+}
+
+func (b *Bluesky) post(status string, embed any) error {
+	record := map[string]any{
+		"$type":     "app.bsky.feed.post",
+		"text":      status,
+		"createdAt": time.Now().UTC().Format(time.RFC3339),
+		"langs":     []string{"en"},
+		"facets":    blueskyLinkFacets(status),
+	}
+	if embed != nil {
+		record["embed"] = embed
+	}
+	return b.call("com.atproto.repo.createRecord", "", map[string]any{
+		"repo":       b.did,
+		"collection": "app.bsky.feed.post",
+		"record":     record,
+	}, nil)
+}
+
+func (b *Bluesky) PostStatus(status string) error {
+	return b.withSession(func() error {
+		return b.post(status, nil)
+	})
+}
+
+// Uploads the image as a blob and posts the status with it embedded.
+func (b *Bluesky) PostStatusWithImageFromReader(status string, file io.Reader, altText string, visibility string) (string, error) {
+	// Hang on to the image in case it has to be uploaded again with a new session.
+	image, err := io.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
+	return "", b.withSession(func() error {
+		var upload struct {
+			Blob json.RawMessage `json:"blob"`
+		}
+		if err := b.call("com.atproto.repo.uploadBlob", "image/png", bytes.NewReader(image), &upload); err != nil {
+			return err
+		}
+		embed := map[string]any{
+			"$type": "app.bsky.embed.images",
+			"images": []map[string]any{{
+				"alt":   altText,
+				"image": upload.Blob,
+			}},
+		}
+		return b.post(status, embed)
+	})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Stands in for a PDS, recording the post records it's sent.
+func newFakePDS(t *testing.T, records chan map[string]any) *httptest.Server {
+	sessions := 0
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("Expected to send a POST request, got: %s", r.Method)
+		}
+		if r.URL.Path != "/xrpc/com.atproto.server.createSession" && r.URL.Path != "/xrpc/com.atproto.server.refreshSession" {
+			if want, got := fmt.Sprintf("Bearer jwt%d", sessions), r.Header.Get("Authorization"); want != got {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte(`{"error":"ExpiredToken","message":"Token has expired"}`))
+				return
+			}
+		}
+		switch r.URL.Path {
+		case "/xrpc/com.atproto.server.createSession":
+			var req map[string]string
+			json.NewDecoder(r.Body).Decode(&req)
+			if req["identifier"] != "qldgridbot.bsky.social" || req["password"] != "app-password" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			sessions++
+			fmt.Fprintf(w, `{"accessJwt":"jwt%d","refreshJwt":"refresh%d","did":"did:plc:qld","handle":"qldgridbot.bsky.social"}`, sessions, sessions)
+		case "/xrpc/com.atproto.server.refreshSession":
+			if want, got := fmt.Sprintf("Bearer refresh%d", sessions), r.Header.Get("Authorization"); want != got {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"ExpiredToken","message":"Token has expired"}`))
+				return
+			}
+			sessions++
+			fmt.Fprintf(w, `{"accessJwt":"jwt%d","refreshJwt":"refresh%d","did":"did:plc:qld","handle":"qldgridbot.bsky.social"}`, sessions, sessions)
+		case "/xrpc/com.atproto.repo.uploadBlob":
+			if want, got := "image/png", r.Header.Get("Content-Type"); want != got {
+				t.Errorf("Expected %s, got %s", want, got)
+			}
+			b, _ := io.ReadAll(r.Body)
+			fmt.Fprintf(w, `{"blob":{"$type":"blob","ref":{"$link":"bafkrei"},"mimeType":"image/png","size":%d}}`, len(b))
+		case "/xrpc/com.atproto.repo.createRecord":
+			var req map[string]any
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Error(err)
+			}
+			if want, got := "did:plc:qld", req["repo"]; want != got {
+				t.Errorf("Expected %s, got %s", want, got)
+			}
+			records <- req["record"].(map[string]any)
+			w.Write([]byte(`{"uri":"at://did:plc:qld/app.bsky.feed.post/1","cid":"bafyrei"}`))
+		default:
+			t.Errorf("Unexpected request to %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestBlueskyPostStatusWithImage(t *testing.T) {
+	records := make(chan map[string]any, 1)
+	server := newFakePDS(t, records)
+	defer server.Close()
+
+	b := NewBluesky(server.URL, "qldgridbot.bsky.social", "app-password")
+	status := fmt.Sprintf(PEAK_TOOT_FORMAT, "Queensland", 1.5, "17:30", 1.2, "17:00", "18:30")
+	if _, err := b.PostStatusWithImageFromReader(status, bytes.NewReader([]byte("png")), "A plot", "public"); err != nil {
+		t.Fatal(err)
+	}
+
+	record := <-records
+	if want, got := status, record["text"]; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	facets := record["facets"].([]any)
+	if want, got := 1, len(facets); want != got {
+		t.Fatalf("Expected %d facets, got %d", want, got)
+	}
+	index := facets[0].(map[string]any)["index"].(map[string]any)
+	start, end := int(index["byteStart"].(float64)), int(index["byteEnd"].(float64))
+	if want, got := AEMO_VISUALISATION_URL, status[start:end]; want != got {
+		t.Errorf("Expected facet over %s, got %s", want, got)
+	}
+
+	images := record["embed"].(map[string]any)["images"].([]any)
+	blob := images[0].(map[string]any)["image"].(map[string]any)
+	if want, got := "bafkrei", blob["ref"].(map[string]any)["$link"]; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if want, got := float64(3), blob["size"]; want != got {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestBlueskyReconnects(t *testing.T) {
+	records := make(chan map[string]any, 1)
+	server := newFakePDS(t, records)
+	defer server.Close()
+
+	b := NewBluesky(server.URL, "qldgridbot.bsky.social", "app-password")
+	if err := b.PostStatus("first"); err != nil {
+		t.Fatal(err)
+	}
+	<-records
+
+	// Pretend the session has expired. It should be refreshed and the post tried again.
+	b.accessJwt = "stale"
+	if err := b.PostStatus("second"); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "second", (<-records)["text"]; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if want, got := "jwt2", b.accessJwt; want != got {
+		t.Errorf("Expected the session to be refreshed to %s, got %s", want, got)
+	}
+
+	// If the refresh token's expired too, it should log in again.
+	b.accessJwt, b.refreshJwt = "stale", "stale"
+	if _, err := b.PostStatusWithImageFromReader("third", bytes.NewReader([]byte("png")), "A plot", "public"); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "third", (<-records)["text"]; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestBlueskyLinkFacets(t *testing.T) {
+	// Facets are byte offsets, so multi-byte characters before the link move it along.
+	text := "Peak → 17:30 https://example.com/a and http://example.com/b"
+	facets := blueskyLinkFacets(text)
+	if want, got := 2, len(facets); want != got {
+		t.Fatalf("Expected %d facets, got %d", want, got)
+	}
+	for i, want := range []string{"https://example.com/a", "http://example.com/b"} {
+		if got := text[facets[i].Index.ByteStart:facets[i].Index.ByteEnd]; want != got {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+		if got := facets[i].Features[0]["uri"]; want != got {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const DISCORD_PLOT_FILENAME = "forecast.png"
+
+// Discord posts to a channel through a webhook.
+type Discord struct {
+	webhookURL string
+	client     *http.Client
+	sleep      func(time.Duration)
+
+	mu sync.Mutex
+	// If Discord has told us we've used up our requests, this is when we can
+	// start sending again.
+	resetAt time.Time
+}
+
+func NewDiscord(webhookURL string) *Discord {
+	return &Discord{
+		webhookURL: webhookURL,
+		client:     &http.Client{Timeout: 30 * time.Second},
+		sleep:      time.Sleep,
+	}
+}
+
+func (d *Discord) Name() string {
+	return "discord"
+}
+
+// When Discord rate limits us it says how long to wait, in fractional seconds,
+// in the response body.
+func discordRetryAfter(resp *http.Response, body []byte) time.Duration {
+	var r struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	if err := json.Unmarshal(body, &r); err == nil && r.RetryAfter > 0 {
+		return time.Duration(r.RetryAfter * float64(time.Second))
+	}
+	return retryAfterHeader(resp)
+}
+
+// Keeps track of the rate limit headers, so we can wait before sending a request
+// rather than having it rejected.
+func (d *Discord) updateRateLimit(resp *http.Response) {
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err != nil || remaining > 0 {
+		return
+	}
+	if resetAfter, err := strconv.ParseFloat(resp.Header.Get("X-RateLimit-Reset-After"), 64); err == nil {
+		d.resetAt = time.Now().Add(time.Duration(resetAfter * float64(time.Second)))
+	}
+}
+
+func (d *Discord) execute(newBody func() (io.Reader, string, error)) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	maxWait := RATE_LIMIT_MAX_WAIT
+	if wait := time.Until(d.resetAt); wait > 0 {
+		if wait > maxWait {
+			return fmt.Errorf("rate limited for %s, longer than we'll wait", wait)
+		}
+		d.sleep(wait)
+		maxWait -= wait
+	}
+	newReq := func() (*http.Request, error) {
+		body, contentType, err := newBody()
+		if err != nil {
+			return nil, err
+		}
+		u, err := url.Parse(d.webhookURL)
+		if err != nil {
+			return nil, err
+		}
+		// Without wait Discord doesn't tell us if the message failed.
+		q := u.Query()
+		q.Set("wait", "true")
+		u.RawQuery = q.Encode()
+		req, err := http.NewRequest("POST", u.String(), body)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", contentType)
+		return req, nil
+	}
+	resp, body, err := doHonouringRetryAfter(d.client, newReq, discordRetryAfter, d.sleep, maxWait)
+	if err != nil {
+		return err
+	}
+	d.updateRateLimit(resp)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("got status code %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+func (d *Discord) PostStatus(status string) error {
+	return d.execute(func() (io.Reader, string, error) {
+		b, err := json.Marshal(map[string]string{"content": status})
+		return bytes.NewReader(b), "application/json", err
+	})
+}
+
+// Posts the status with the image attached and shown in an embed.
+func (d *Discord) PostStatusWithImageFromReader(status string, file io.Reader, altText string, visibility string) (string, error) {
+	image, err := io.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(map[string]any{
+		"content": status,
+		"embeds": []map[string]any{{
+			"image": map[string]string{"url": "attachment://" + DISCORD_PLOT_FILENAME},
+		}},
+		"attachments": []map[string]any{{
+			"id":          0,
+			"filename":    DISCORD_PLOT_FILENAME,
+			"description": altText,
+		}},
+	})
+	if err != nil {
+		return "", err
+	}
+	return "", d.execute(func() (io.Reader, string, error) {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		mw.WriteField("payload_json", string(payload))
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="files[0]"; filename="%s"`, DISCORD_PLOT_FILENAME))
+		h.Set("Content-Type", "image/png")
+		fw, err := mw.CreatePart(h)
+		if err != nil {
+			return nil, "", err
+		}
+		fw.Write(image)
+		if err := mw.Close(); err != nil {
+			return nil, "", err
+		}
+		return &buf, mw.FormDataContentType(), nil
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDiscordPostWithImage(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if want, got := "true", r.URL.Query().Get("wait"); want != got {
+			t.Errorf("Expected wait=%s, got %s", want, got)
+		}
+		if requests == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"message":"You are being rate limited.","retry_after":0.25,"global":false}`))
+			return
+		}
+		if requests == 3 {
+			var payload map[string]string
+			json.NewDecoder(r.Body).Decode(&payload)
+			if want, got := "Another peak!", payload["content"]; want != got {
+				t.Errorf("Expected %s, got %s", want, got)
+			}
+			return
+		}
+		var payload map[string]any
+		if err := json.Unmarshal([]byte(r.FormValue("payload_json")), &payload); err != nil {
+			t.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if want, got := "A peak!", payload["content"]; want != got {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+		image := payload["embeds"].([]any)[0].(map[string]any)["image"].(map[string]any)
+		if want, got := "attachment://forecast.png", image["url"]; want != got {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+		f, h, err := r.FormFile("files[0]")
+		if err != nil {
+			t.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if want, got := "forecast.png", h.Filename; want != got {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+		if b, _ := io.ReadAll(f); !bytes.Equal([]byte("png"), b) {
+			t.Errorf("Expected png, got %s", b)
+		}
+		// That was our last request for a while.
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset-After", "20")
+		w.Write([]byte(`{"id":"1"}`))
+	}))
+	defer server.Close()
+
+	var slept []time.Duration
+	d := NewDiscord(server.URL)
+	d.sleep = func(d time.Duration) { slept = append(slept, d) }
+
+	if _, err := d.PostStatusWithImageFromReader("A peak!", bytes.NewReader([]byte("png")), "A plot", "public"); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1, len(slept); want != got {
+		t.Fatalf("Expected to wait %d times, waited %d", want, got)
+	}
+	if want, got := 250*time.Millisecond, slept[0]; want != got {
+		t.Errorf("Expected to wait %v, waited %v", want, got)
+	}
+
+	// The next post should wait for the rate limit to reset before sending.
+	if err := d.PostStatus("Another peak!"); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 2, len(slept); want != got {
+		t.Fatalf("Expected to wait %d times, waited %d", want, got)
+	}
+	if slept[1] < 19*time.Second || slept[1] > 20*time.Second {
+		t.Errorf("Expected to wait about 20s, waited %v", slept[1])
+	}
+}
+
+// If the rate limit won't reset for longer than we're prepared to wait, the post
+// is dropped rather than holding everything else up.
+func TestDiscordGivesUpOnLongRateLimits(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"id":"1"}`))
+	}))
+	defer server.Close()
+
+	d := NewDiscord(server.URL)
+	d.sleep = func(time.Duration) { t.Error("Expected not to wait") }
+	d.resetAt = time.Now().Add(RATE_LIMIT_MAX_WAIT + time.Minute)
+	if err := d.PostStatus("A peak!"); err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	if want, got := 0, requests; want != got {
+		t.Errorf("Expected %d requests, got %d", want, got)
+	}
+}
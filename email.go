@@ -0,0 +1,452 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"math"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const EMAIL_PLOT_CONTENT_ID = "forecast"
+
+// How long sending an email can take, from dialling the server to hanging up.
+const EMAIL_TIMEOUT = 30 * time.Second
+
+// How long to wait before trying a digest again after it fails to send.
+const EMAIL_DIGEST_RETRY = 30 * time.Minute
+
+// Email sends peak events by email as soon as they happen, and optionally a
+// daily digest comparing each region's actual prices with what was forecast.
+// One is shared by every GridBot.
+type Email struct {
+	host   string
+	addr   string
+	auth   smtp.Auth
+	from   string
+	to     []string
+	digest bool
+	now    func() time.Time
+
+	mu            sync.Mutex
+	digestDay     time.Time // Midnight, NEM time, at the start of the earliest day that hasn't been sent.
+	digestSending bool      // True while a digest is being sent.
+	digestRetryAt time.Time // Don't try the digest again before this, after it failed to send.
+	actuals       map[RegionID]map[time.Time]float64
+	forecasts     map[RegionID]map[time.Time]float64
+}
+
+func NewEmail(host string, port int, username, password, from string, to []string, digest bool) *Email {
+	e := &Email{
+		host:      host,
+		addr:      net.JoinHostPort(host, strconv.Itoa(port)),
+		from:      from,
+		to:        to,
+		digest:    digest,
+		now:       time.Now,
+		actuals:   make(map[RegionID]map[time.Time]float64),
+		forecasts: make(map[RegionID]map[time.Time]float64),
+	}
+	if username != "" {
+		e.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return e
+}
+
+func (e *Email) Name() string {
+	return "email"
+}
+
+// Writes a quoted-printable MIME part.
+func writeTextPart(w *multipart.Writer, contentType, text string) error {
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", contentType+"; charset=utf-8")
+	h.Set("Content-Transfer-Encoding", "quoted-printable")
+	pw, err := w.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	qw := quotedprintable.NewWriter(pw)
+	if _, err := qw.Write([]byte(text)); err != nil {
+		return err
+	}
+	return qw.Close()
+}
+
+// Builds a message with plain text and HTML alternatives. If image is set it's
+// attached inline, and the HTML can refer to it as cid:forecast.
+func (e *Email) buildMessage(subject, text, htmlText string, image []byte) ([]byte, error) {
+	var alt bytes.Buffer
+	altWriter := multipart.NewWriter(&alt)
+	if err := writeTextPart(altWriter, "text/plain", text); err != nil {
+		return nil, err
+	}
+	if err := writeTextPart(altWriter, "text/html", htmlText); err != nil {
+		return nil, err
+	}
+	if err := altWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", e.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", e.now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+
+	if image == nil {
+		fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", altWriter.Boundary())
+		msg.Write(alt.Bytes())
+		return msg.Bytes(), nil
+	}
+
+	var related bytes.Buffer
+	relatedWriter := multipart.NewWriter(&related)
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", "multipart/alternative; boundary="+altWriter.Boundary())
+	pw, err := relatedWriter.CreatePart(h)
+	if err != nil {
+		return nil, err
+	}
+	pw.Write(alt.Bytes())
+
+	h = make(textproto.MIMEHeader)
+	h.Set("Content-Type", "image/png")
+	h.Set("Content-Transfer-Encoding", "base64")
+	h.Set("Content-ID", "<"+EMAIL_PLOT_CONTENT_ID+">")
+	h.Set("Content-Disposition", `inline; filename="forecast.png"`)
+	if pw, err = relatedWriter.CreatePart(h); err != nil {
+		return nil, err
+	}
+	// Base64 lines in an email must be no longer than 76 characters.
+	encoded := base64.StdEncoding.EncodeToString(image)
+	for len(encoded) > 76 {
+		fmt.Fprintf(pw, "%s\r\n", encoded[:76])
+		encoded = encoded[76:]
+	}
+	fmt.Fprintf(pw, "%s\r\n", encoded)
+	if err := relatedWriter.Close(); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(&msg, "Content-Type: multipart/related; boundary=%s\r\n\r\n", relatedWriter.Boundary())
+	msg.Write(related.Bytes())
+	return msg.Bytes(), nil
+}
+
+func (e *Email) send(subject, text, htmlText string, image []byte) error {
+	msg, err := e.buildMessage(subject, text, htmlText, image)
+	if err != nil {
+		return err
+	}
+	return e.sendMail(msg)
+}
+
+// Works like smtp.SendMail, but gives up after EMAIL_TIMEOUT so a server that
+// stops responding can't hang the GridBot sending it.
+func (e *Email) sendMail(msg []byte) error {
+	conn, err := net.DialTimeout("tcp", e.addr, EMAIL_TIMEOUT)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(EMAIL_TIMEOUT)); err != nil {
+		return err
+	}
+	c, err := smtp.NewClient(conn, e.host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: e.host}); err != nil {
+			return err
+		}
+	}
+	if e.auth != nil {
+		if ok, _ := c.Extension("AUTH"); ok {
+			if err := c.Auth(e.auth); err != nil {
+				return err
+			}
+		}
+	}
+	if err := c.Mail(e.from); err != nil {
+		return err
+	}
+	for _, to := range e.to {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (e *Email) PostStatus(status string) error {
+	return e.send("AusGridBot", status, "<p>"+html.EscapeString(status)+"</p>", nil)
+}
+
+func (e *Email) PostStatusWithImageFromReader(status string, file io.Reader, altText string, visibility string) (string, error) {
+	image, err := io.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
+	return "", e.send("AusGridBot", status, peakEmailHTML(status, altText), image)
+}
+
+func peakEmailHTML(status, altText string) string {
+	if altText == "" {
+		altText = "Price forecast"
+	}
+	return "<p>" + html.EscapeString(status) + `</p><p><img src="cid:` + EMAIL_PLOT_CONTENT_ID + `" alt="` + html.EscapeString(altText) + `"></p>`
+}
+
+func (e *Email) NotifyEvent(event PeakEvent, image []byte) error {
+	regionString, err := RegionIDToRegionString(event.RegionID)
+	if err != nil {
+		return err
+	}
+	var subject string
+	switch event.Type {
+	case PeakEventPeak:
+		subject = regionString + " electricity price peak forecast"
+	case PeakEventDowngrade:
+		subject = regionString + " electricity price peak downgraded"
+	case PeakEventCancelled:
+		subject = regionString + " electricity price peak averted"
+	case PeakEventOutcome:
+		subject = regionString + " electricity price peak outcome"
+	case PeakEventTrough:
+		subject = regionString + " electricity price trough forecast"
+	case PeakEventTroughUpdate:
+		subject = regionString + " electricity price trough updated"
+	case PeakEventTroughCancelled:
+		subject = regionString + " electricity price trough cancelled"
+	}
+	if image == nil {
+		return e.send(subject, event.Message, "<p>"+html.EscapeString(event.Message)+"</p>", nil)
+	}
+	return e.send(subject, event.Message, peakEmailHTML(event.Message, event.ImageDescription), image)
+}
+
+// Returns midnight at the start of the NEM day that t falls in.
+func nemDay(t time.Time) time.Time {
+	t = inNEMTime(t)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// Settlement dates are the end of the interval, so the interval ending at
+// midnight belongs to the day before.
+func intervalDay(settlementDate time.Time) time.Time {
+	return nemDay(settlementDate.Add(-time.Nanosecond))
+}
+
+// Records actual and forecast prices for the daily digest. Once a day has
+// passed the digest for it is sent in the background, since every GridBot calls
+// this from its main loop. A day's prices are only forgotten once its digest has
+// gone out.
+func (e *Email) ObserveInterval(i Interval) {
+	if !e.digest {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	today := nemDay(now)
+	if e.digestDay.IsZero() {
+		e.digestDay = today
+	}
+	if today.After(e.digestDay) && !e.digestSending && !now.Before(e.digestRetryAt) {
+		day := e.digestDay
+		subject, text, htmlText, ok := e.digestFor(day)
+		if ok {
+			e.digestSending = true
+			go e.sendDigest(day, subject, text, htmlText)
+		} else {
+			e.digestSent(day)
+		}
+	}
+
+	if intervalDay(i.SettlementDate.Time).Before(e.digestDay) {
+		return
+	}
+	// Times are keyed in UTC so the keys compare equal whatever location the
+	// intervals were parsed in.
+	t := i.SettlementDate.Time.UTC()
+	switch i.PeriodType {
+	case "ACTUAL":
+		if e.actuals[i.RegionID] == nil {
+			e.actuals[i.RegionID] = make(map[time.Time]float64)
+		}
+		e.actuals[i.RegionID][t] = i.RRP
+	case "FORECAST":
+		if e.forecasts[i.RegionID] == nil {
+			e.forecasts[i.RegionID] = make(map[time.Time]float64)
+		}
+		// Once the actual price is in, later forecasts for the same period
+		// don't count.
+		if _, ok := e.actuals[i.RegionID][t]; !ok {
+			e.forecasts[i.RegionID][t] = i.RRP
+		}
+	}
+}
+
+// Sends the digest for day, and moves on to the next day if it went out.
+func (e *Email) sendDigest(day time.Time, subject, text, htmlText string) {
+	err := e.send(subject, text, htmlText, nil)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.digestSending = false
+	if err != nil {
+		slog.Error("Failed to send digest email", "day", day.Format("2006-01-02"), "err", err)
+		e.digestRetryAt = e.now().Add(EMAIL_DIGEST_RETRY)
+		return
+	}
+	e.digestSent(day)
+}
+
+// Forgets the prices for day and the days before it, and starts on the next.
+func (e *Email) digestSent(day time.Time) {
+	next := day.AddDate(0, 0, 1)
+	e.pruneBefore(next)
+	e.digestDay = next
+}
+
+func (e *Email) pruneBefore(day time.Time) {
+	for _, m := range []map[RegionID]map[time.Time]float64{e.actuals, e.forecasts} {
+		for _, prices := range m {
+			for t := range prices {
+				if intervalDay(t).Before(day) {
+					delete(prices, t)
+				}
+			}
+		}
+	}
+}
+
+type digestRow struct {
+	regionString  string
+	actualAverage float64
+	actualMax     float64
+	actualMaxTime time.Time
+	periods       int // How many half hours had both a forecast and an actual.
+	meanAbsError  float64
+	worstError    float64 // Actual minus forecast, for the period that was furthest off.
+	worstTime     time.Time
+}
+
+// Summarises one region's day. Actuals are five minutely and forecasts half
+// hourly, so each forecast is compared with the average of the actuals in its
+// half hour. Returns false if there were no actuals that day.
+func (e *Email) digestRowFor(regionID RegionID, day time.Time) (digestRow, bool) {
+	var row digestRow
+	var err error
+	if row.regionString, err = RegionIDToRegionString(regionID); err != nil {
+		return row, false
+	}
+
+	count := 0
+	for t, rrp := range e.actuals[regionID] {
+		if !intervalDay(t).Equal(day) {
+			continue
+		}
+		row.actualAverage += rrp
+		if count == 0 || rrp > row.actualMax {
+			row.actualMax = rrp
+			row.actualMaxTime = t
+		}
+		count++
+	}
+	if count == 0 {
+		return row, false
+	}
+	row.actualAverage /= float64(count)
+
+	for t, forecast := range e.forecasts[regionID] {
+		if !intervalDay(t).Equal(day) {
+			continue
+		}
+		actual, n := 0.0, 0
+		for at, rrp := range e.actuals[regionID] {
+			if at.After(t.Add(-30*time.Minute)) && !at.After(t) {
+				actual += rrp
+				n++
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		diff := actual/float64(n) - forecast
+		row.meanAbsError += math.Abs(diff)
+		if row.periods == 0 || math.Abs(diff) > math.Abs(row.worstError) {
+			row.worstError = diff
+			row.worstTime = t
+		}
+		row.periods++
+	}
+	if row.periods > 0 {
+		row.meanAbsError /= float64(row.periods)
+	}
+	return row, true
+}
+
+// Writes up the digest for day. ok is false if there's nothing to send.
+func (e *Email) digestFor(day time.Time) (subject, text, htmlText string, ok bool) {
+	regionIDs := make([]RegionID, 0, len(e.actuals))
+	for r := range e.actuals {
+		regionIDs = append(regionIDs, r)
+	}
+	sort.Slice(regionIDs, func(i, j int) bool { return regionIDs[i] < regionIDs[j] })
+
+	var textBuilder, htmlBuilder strings.Builder
+	subject = "AusGridBot daily digest for " + day.Format("Monday 2 January 2006")
+	fmt.Fprintf(&textBuilder, "Wholesale electricity prices for %s, in $/MWh. Times are NEM time (AEST).\n\n", day.Format("2 January 2006"))
+	fmt.Fprintf(&htmlBuilder, "<p>Wholesale electricity prices for %s, in $/MWh. Times are NEM time (AEST).</p>\n", day.Format("2 January 2006"))
+	htmlBuilder.WriteString("<table>\n<tr><th>Region</th><th>Average</th><th>Highest</th><th>Mean forecast error</th><th>Worst forecast</th></tr>\n")
+
+	rows := 0
+	for _, regionID := range regionIDs {
+		row, ok := e.digestRowFor(regionID, day)
+		if !ok {
+			continue
+		}
+		rows++
+		highest := fmt.Sprintf("%.2f at %s", row.actualMax, inNEMTime(row.actualMaxTime).Format("15:04 MST"))
+		meanError, worst := "no forecast", "no forecast"
+		if row.periods > 0 {
+			meanError = fmt.Sprintf("%.2f", row.meanAbsError)
+			worst = fmt.Sprintf("%+.2f at %s", row.worstError, inNEMTime(row.worstTime).Format("15:04 MST"))
+		}
+		fmt.Fprintf(&textBuilder, "%s: averaged %.2f, highest %s. Forecasts were off by %s on average, worst %s.\n",
+			row.regionString, row.actualAverage, highest, meanError, worst)
+		fmt.Fprintf(&htmlBuilder, "<tr><td>%s</td><td>%.2f</td><td>%s</td><td>%s</td><td>%s</td></tr>\n",
+			html.EscapeString(row.regionString), row.actualAverage, highest, meanError, worst)
+	}
+	htmlBuilder.WriteString("</table>\n")
+	return subject, textBuilder.String(), htmlBuilder.String(), rows > 0
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Stands in for an SMTP server, passing each message it receives to a channel.
+func newFakeSMTPServer(t *testing.T) (host string, port int, messages chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	messages = make(chan string, 10)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+				reply("220 localhost ESMTP")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					cmd := strings.ToUpper(strings.TrimSpace(line))
+					switch {
+					case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+						reply("250 localhost")
+					case strings.HasPrefix(cmd, "DATA"):
+						reply("354 go ahead")
+						var msg strings.Builder
+						for {
+							l, err := r.ReadString('\n')
+							if err != nil {
+								return
+							}
+							if l == ".\r\n" {
+								break
+							}
+							msg.WriteString(strings.TrimPrefix(l, "."))
+						}
+						messages <- msg.String()
+						reply("250 ok")
+					case strings.HasPrefix(cmd, "QUIT"):
+						reply("221 bye")
+						return
+					default:
+						reply("250 ok")
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	host, portString, _ := net.SplitHostPort(ln.Addr().String())
+	port, _ = strconv.Atoi(portString)
+	return host, port, messages
+}
+
+func waitForEmail(messages chan string, t *testing.T) *mail.Message {
+	select {
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for email")
+	case m := <-messages:
+		msg, err := mail.ReadMessage(strings.NewReader(m))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+	return nil
+}
+
+// Returns the decoded parts of a multipart body, keyed by content type, looking
+// inside any nested multiparts.
+func emailParts(contentType string, body io.Reader, t *testing.T) map[string][]byte {
+	parts := make(map[string][]byte)
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		t.Fatalf("Expected a multipart, got %s", mediaType)
+	}
+	r := multipart.NewReader(body, params["boundary"])
+	for {
+		p, err := r.NextRawPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		partType, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		if strings.HasPrefix(partType, "multipart/") {
+			for k, v := range emailParts(p.Header.Get("Content-Type"), p, t) {
+				parts[k] = v
+			}
+			continue
+		}
+		var decoded io.Reader = p
+		switch p.Header.Get("Content-Transfer-Encoding") {
+		case "base64":
+			decoded = base64.NewDecoder(base64.StdEncoding, p)
+		case "quoted-printable":
+			decoded = quotedprintable.NewReader(p)
+		}
+		b, err := io.ReadAll(decoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[partType] = b
+	}
+	return parts
+}
+
+func TestEmailPeakEvent(t *testing.T) {
+	host, port, messages := newFakeSMTPServer(t)
+	e := NewEmail(host, port, "", "", "gridbot@example.com", []string{"a@example.com", "b@example.com"}, false)
+
+	image := bytes.Repeat([]byte("png"), 100)
+	event := PeakEvent{
+		Type:     PeakEventPeak,
+		RegionID: "SA1",
+		RRP:      1500,
+		Message:  "A new South Australia wholesale electricity price peak of $1.50/kWh is predicted at 17:30",
+	}
+	if err := e.NotifyEvent(event, image); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := waitForEmail(messages, t)
+	if want, got := "South Australia electricity price peak forecast", msg.Header.Get("Subject"); want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if want, got := "a@example.com, b@example.com", msg.Header.Get("To"); want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	parts := emailParts(msg.Header.Get("Content-Type"), msg.Body, t)
+	if want, got := event.Message, string(parts["text/plain"]); want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if !strings.Contains(string(parts["text/html"]), `src="cid:forecast"`) {
+		t.Errorf("Expected the HTML to show the inline image, got %s", parts["text/html"])
+	}
+	if !bytes.Equal(image, parts["image/png"]) {
+		t.Errorf("Inline image doesn't match")
+	}
+}
+
+func TestEmailDigest(t *testing.T) {
+	host, port, messages := newFakeSMTPServer(t)
+	e := NewEmail(host, port, "", "", "gridbot@example.com", []string{"a@example.com"}, true)
+
+	brisbaneLocation, err := time.LoadLocation("Australia/Brisbane")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 30, 12, 0, 0, 0, brisbaneLocation)
+	e.now = func() time.Time { return now }
+
+	periodEnd := time.Date(2024, 1, 30, 17, 30, 0, 0, brisbaneLocation)
+	interval := func(periodType string, t time.Time, rrp float64) Interval {
+		return Interval{SettlementDate: JSONTime{t}, RegionID: "QLD1", Region: "QLD1", PeriodType: periodType, RRP: rrp}
+	}
+	// The forecast for the half hour, then a revised one that should win.
+	e.ObserveInterval(interval("FORECAST", periodEnd, 500))
+	e.ObserveInterval(interval("FORECAST", periodEnd, 400))
+	// Six five minute actuals averaging 300.
+	for n := 0; n < 6; n++ {
+		e.ObserveInterval(interval("ACTUAL", periodEnd.Add(time.Duration(n-5)*5*time.Minute), 250+float64(n)*20))
+	}
+	// A forecast arriving after the actuals shouldn't count.
+	e.ObserveInterval(interval("FORECAST", periodEnd, 1000))
+
+	select {
+	case <-messages:
+		t.Fatal("Didn't expect a digest before the day was over")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	now = time.Date(2024, 1, 31, 0, 10, 0, 0, brisbaneLocation)
+	e.ObserveInterval(interval("ACTUAL", now, 100))
+
+	msg := waitForEmail(messages, t)
+	if want, got := "AusGridBot daily digest for Tuesday 30 January 2024", msg.Header.Get("Subject"); want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	parts := emailParts(msg.Header.Get("Content-Type"), msg.Body, t)
+	text := string(parts["text/plain"])
+	for _, want := range []string{"Queensland: averaged 300.00", "highest 350.00 at 17:30 AEST", "off by 100.00 on average", "worst -100.00 at 17:30 AEST"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %q in %s", want, text)
+		}
+	}
+	if !strings.Contains(string(parts["text/html"]), "<td>Queensland</td>") {
+		t.Errorf("Expected a row for Queensland in %s", parts["text/html"])
+	}
+}
+
+// Waits for the digest that's being sent in the background to finish.
+func waitForDigest(e *Email, t *testing.T) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		e.mu.Lock()
+		sending := e.digestSending
+		e.mu.Unlock()
+		if !sending {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Timed out waiting for the digest to send")
+}
+
+// A digest that fails to send keeps its day's prices and is tried again later.
+func TestEmailDigestRetries(t *testing.T) {
+	host, port, messages := newFakeSMTPServer(t)
+	e := NewEmail(host, port, "", "", "gridbot@example.com", []string{"a@example.com"}, true)
+	now := time.Date(2024, 1, 30, 12, 0, 0, 0, NEMTime)
+	e.now = func() time.Time { return now }
+	interval := func(t time.Time, rrp float64) Interval {
+		return Interval{SettlementDate: JSONTime{t}, RegionID: "QLD1", Region: "QLD1", PeriodType: "ACTUAL", RRP: rrp}
+	}
+	e.ObserveInterval(interval(now, 300))
+
+	// Nothing's listening here.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := e.addr
+	e.addr = ln.Addr().String()
+	ln.Close()
+
+	now = time.Date(2024, 1, 31, 0, 10, 0, 0, NEMTime)
+	e.ObserveInterval(interval(now, 100))
+	waitForDigest(e, t)
+
+	// Not straight away.
+	e.addr = addr
+	now = now.Add(EMAIL_DIGEST_RETRY / 2)
+	e.ObserveInterval(interval(now, 100))
+	waitForDigest(e, t)
+	select {
+	case <-messages:
+		t.Fatal("Didn't expect the digest to be tried again yet")
+	default:
+	}
+
+	now = now.Add(EMAIL_DIGEST_RETRY)
+	e.ObserveInterval(interval(now, 100))
+	msg := waitForEmail(messages, t)
+	if want, got := "AusGridBot daily digest for Tuesday 30 January 2024", msg.Header.Get("Subject"); want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	parts := emailParts(msg.Header.Get("Content-Type"), msg.Body, t)
+	if want, got := "Queensland: averaged 300.00", string(parts["text/plain"]); !strings.Contains(got, want) {
+		t.Errorf("Expected %q in %s", want, got)
+	}
+	waitForDigest(e, t)
+	if want, got := time.Date(2024, 1, 31, 0, 0, 0, 0, NEMTime), e.digestDay; !want.Equal(got) {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
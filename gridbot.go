@@ -3,36 +3,77 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"math"
+	"sync"
 	"time"
 )
 
+// These are the defaults for GridBotCfg.PeakEnterRRP and PeakDeltaRRP.
 const INTERESTING_PEAK_RRP = 500
 
 // This amounts to 5 cents /kWh
 const UNINTERESTING_DELTA_RRP = 50
-const PEAK_TOOT_FORMAT = "A new %s wholesale electricity price peak of $%.2f/kWh is predicted at %s: https://aemo.com.au/aemo/apps/visualisations/elec-nem-priceanddemand.html"
-const PEAK_DOWNGRADE_TOOT_FORMAT = "The %s predicted wholesale electricity price peak of $%.2f/kWh has been downgraded to a peak of $%.2f/kWh at %s: https://aemo.com.au/aemo/apps/visualisations/elec-nem-priceanddemand.html"
-const PEAK_CANCELLED_TOOT_FORMAT = "The %s wholesale electricity price peak of $%.2f/kWh at %s has been averted. Thanks AEMO! https://aemo.com.au/aemo/apps/visualisations/elec-nem-priceanddemand.html"
+const AEMO_VISUALISATION_URL = "https://aemo.com.au/aemo/apps/visualisations/elec-nem-priceanddemand.html"
+const PEAK_TOOT_FORMAT = "A new %s wholesale electricity price peak of $%.2f/kWh is predicted at %s, with prices averaging $%.2f/kWh from %s to %s: " + AEMO_VISUALISATION_URL
+const PEAK_DOWNGRADE_TOOT_FORMAT = "The %s predicted wholesale electricity price peak of $%.2f/kWh has been downgraded to a peak of $%.2f/kWh at %s, with prices averaging $%.2f/kWh from %s to %s: " + AEMO_VISUALISATION_URL
+const PEAK_CANCELLED_TOOT_FORMAT = "The %s wholesale electricity price peak of $%.2f/kWh at %s has been averted. Thanks AEMO! " + AEMO_VISUALISATION_URL
+
+// Appended to a peak toot when it's edited rather than downgraded.
+const PEAK_REVISED_NOTE_FORMAT = "\n\nRevised at %s."
+
+// These are the values of GridBotCfg.DowngradeMode.
+const DOWNGRADE_MODE_REPLY = "reply" // Downgrades are replies to the peak toot.
+const DOWNGRADE_MODE_EDIT = "edit"   // The peak toot is edited, where the notifier can.
 
 const INTRO_TOOT = "Testing, testing, 1, 2, 3. This is a test toot from the %s gridbot. If you see this, it's working."
 
 type GridBot struct {
-	m                  *Mastodon
+	notifiers          []Notifier
 	input              chan Interval
 	cfg                GridBotCfg
 	regionString       string
-	lastTootedPeakRRP  float64
+	location           *time.Location // The region's local time zone, for showing times to people.
+	lastTootedPeakRRP  float64        // The peak in the last peak toot, or the new peak after a cancellation.
 	lastTootedPeakTime time.Time
+	lastTootedPeakIDs  StatusIDs    // The toot that announced the last tooted peak, which updates to it reply to.
+	tootedPeaks        []TootedPeak // The peak windows we've tooted about that are still coming up.
+	pendingOutcomes    []TootedPeak // The peak windows that have passed, waiting on actuals to follow up.
+	lastTootedTrough   PriceWindow  // Zero if we haven't tooted about a trough, or it's over.
 	lastToot           string
+	stateRestored      bool // True if the last tooted peak was loaded from the state store.
 
 	forecasts      []Interval // This stores some forecast data for graphing.
 	forecastsStale bool       // When true a newly received interval will clear forecasts.
 	peakRRP        float64
 	peakTime       time.Time
+	latestActual   Interval
+	actuals        map[int64]Interval // The recent actual intervals, by the Unix time of their settlement date.
+	now            func() time.Time   // Returns the time, so tests can wind the clock on.
+
+	// The above is only touched by Mainloop. Anything else that wants to know
+	// what's going on reads this copy, which is updated after each batch.
+	statusMu sync.RWMutex
+	status   GridBotStatus
+}
+
+// GridBotStatus is a snapshot of what a GridBot knows as of its last batch of
+// intervals.
+type GridBotStatus struct {
+	RegionID           RegionID
+	Region             string
+	Location           *time.Location
+	Forecasts          []Interval
+	Actuals            []Interval // The actual intervals from the PLOT_ACTUALS_HISTORY before UpdatedAt.
+	PeakRRP            float64
+	PeakTime           time.Time
+	PeakWindows        []PriceWindow // Every stretch of prices above the peak exit threshold.
+	LastTootedPeakRRP  float64
+	LastTootedPeakTime time.Time
+	UpdatedAt          time.Time // Zero until the first batch of forecasts arrives.
 }
 
 func BuildGridBots(cfg config) (gridBotMap, error) {
@@ -43,7 +84,27 @@ func BuildGridBots(cfg config) (gridBotMap, error) {
 	// Deserialise the credentials envar
 	var credentials []GridBotCfg
 	if err := json.Unmarshal([]byte(cfg.GridBotCredentials), &credentials); err != nil {
-		slog.Error("Failed to deserialise credentials:", err)
+		slog.Error("Failed to deserialise credentials", "err", err)
+	}
+
+	var store StateStore
+	if store, err = NewStateStore(cfg.StateStore, cfg.StatePath); err != nil {
+		return nil, fmt.Errorf("failed to open state store: %s", err)
+	}
+
+	var templatesCfg TootTemplatesCfg
+	if cfg.TootTemplatesPath != "" {
+		if templatesCfg, err = LoadTootTemplatesCfg(cfg.TootTemplatesPath); err != nil {
+			slog.Error("Failed to load toot templates, using the built-in ones", "err", err)
+		}
+	}
+	// Bad templates shouldn't stop us tooting, so they're swapped for the built-in ones.
+	templates := func(regionID RegionID) *TootTemplates {
+		t, err := templatesCfg.ForRegion(regionID)
+		if err != nil {
+			slog.Error("Invalid toot templates, using the built-in ones in their place", "region", regionID, "err", err)
+		}
+		return t
 	}
 
 	if len(credentials) == 0 {
@@ -57,6 +118,8 @@ func BuildGridBots(cfg config) (gridBotMap, error) {
 			MastodonUserPassword: cfg.MastodonUserPassword,
 			TestMode:             cfg.TestMode,
 			MastodonURL:          cfg.MastodonURL,
+			StateStore:           store,
+			Templates:            templates("QLD1"),
 		}
 		if gridBots["QLD1"], err = NewGridBot(gbCfg); err != nil {
 			return nil, fmt.Errorf("failed to create GridBot: %s", err)
@@ -64,14 +127,13 @@ func BuildGridBots(cfg config) (gridBotMap, error) {
 	} else {
 		slog.Info("Using credentials from JSON envar.")
 		for _, c := range credentials {
-			newCFG := GridBotCfg{
-				RegionID:             c.RegionID,
-				MastodonClientID:     c.MastodonClientID,
-				MastodonClientSecret: c.MastodonClientSecret,
-				MastodonUserEmail:    c.MastodonUserEmail,
-				MastodonUserPassword: c.MastodonUserPassword,
-				TestMode:             cfg.TestMode,
-				MastodonURL:          cfg.MastodonURL,
+			newCFG := c
+			newCFG.TestMode = cfg.TestMode
+			newCFG.MastodonURL = cfg.MastodonURL
+			newCFG.StateStore = store
+			newCFG.Templates = templates(c.RegionID)
+			if err := newCFG.Validate(); err != nil {
+				return nil, fmt.Errorf("invalid config for %s: %s", c.RegionID, err)
 			}
 			if gridBots[c.RegionID], err = NewGridBot(newCFG); err != nil {
 				return nil, fmt.Errorf("failed to create GridBot: %s", err)
@@ -104,56 +166,196 @@ func RegionIDToRegionString(regionID RegionID) (string, error) {
 }
 
 func NewGridBot(cfg GridBotCfg) (*GridBot, error) {
-	gb := &GridBot{}
-	gb.cfg = cfg
+	gb := &GridBot{actuals: make(map[int64]Interval), now: time.Now}
+	gb.cfg = cfg.withDefaults()
 	if s, err := RegionIDToRegionString(cfg.RegionID); err != nil {
 		return nil, fmt.Errorf("failed to convert region ID \"%s\" to string: %s", cfg.RegionID, err)
 	} else {
 		gb.regionString = s
 	}
+	if l, err := RegionLocation(cfg.RegionID); err != nil {
+		return nil, fmt.Errorf("failed to load time zone for region \"%s\": %s", cfg.RegionID, err)
+	} else {
+		gb.location = l
+	}
+	if cfg.TestMode {
+		gb.AddNotifier(LogNotifier{})
+	} else {
+		gb.addConfiguredNotifiers()
+	}
+	gb.stateRestored = gb.loadState()
+	gb.status = GridBotStatus{
+		RegionID:           cfg.RegionID,
+		Region:             gb.regionString,
+		Location:           gb.location,
+		LastTootedPeakRRP:  gb.lastTootedPeakRRP,
+		LastTootedPeakTime: gb.lastTootedPeakTime,
+	}
 	gb.resetIntervalChannel()
 	// gb.SendTestToot()
 	return gb, nil
 }
 
+// Adds a notifier for each service that has credentials in the config.
+func (gb *GridBot) addConfiguredNotifiers() {
+	cfg := gb.cfg
+	if cfg.MastodonClientID != "" {
+		gb.AddNotifier(NewMastodon(cfg.MastodonURL,
+			cfg.MastodonClientID,
+			cfg.MastodonClientSecret,
+			cfg.MastodonUserEmail,
+			cfg.MastodonUserPassword))
+	}
+	if cfg.BlueskyHandle != "" {
+		gb.AddNotifier(NewBluesky(cfg.BlueskyPDSURL, cfg.BlueskyHandle, cfg.BlueskyAppPassword))
+	}
+	if cfg.MatrixRoomID != "" {
+		gb.AddNotifier(NewMatrix(cfg.MatrixHomeserverURL, cfg.MatrixAccessToken, cfg.MatrixRoomID))
+	}
+	if cfg.TelegramChatID != "" {
+		gb.AddNotifier(NewTelegram("", cfg.TelegramBotToken, cfg.TelegramChatID))
+	}
+	if cfg.DiscordWebhookURL != "" {
+		gb.AddNotifier(NewDiscord(cfg.DiscordWebhookURL))
+	}
+	for _, w := range cfg.Webhooks {
+		gb.AddNotifier(NewWebhook(w.URL, w.Secret))
+	}
+}
+
 func (gb *GridBot) GetIntervalChannel() chan Interval {
 	return gb.input
 }
 
 func (gb *GridBot) SendTestToot() {
-	if err := gb.sendToot(fmt.Sprintf(INTRO_TOOT, gb.regionString), nil); err != nil {
-		slog.Error("Failed to send test toot:", err)
+	if _, _, err := gb.sendToot(fmt.Sprintf(INTRO_TOOT, gb.regionString), nil, nil, nil, ""); err != nil {
+		slog.Error("Failed to send test toot", "err", err)
 	}
 }
 
-func (gb *GridBot) sendToot(toot string, reader io.Reader) error {
-	if gb.cfg.TestMode {
-		slog.Info("Would toot", "toot", toot)
-		return nil
+// Adds somewhere for this GridBot to post its toots.
+func (gb *GridBot) AddNotifier(n Notifier) {
+	gb.notifiers = append(gb.notifiers, n)
+}
+
+// Returns the Mastodon notifier, if this GridBot has one.
+func (gb *GridBot) mastodon() *Mastodon {
+	for _, n := range gb.notifiers {
+		if m, ok := n.(*Mastodon); ok {
+			return m
+		}
 	}
-	var err error
-	if gb.m == nil {
-		gb.m, err = NewMastodon(gb.cfg.MastodonURL,
-			gb.cfg.MastodonClientID,
-			gb.cfg.MastodonClientSecret,
-			gb.cfg.MastodonUserEmail,
-			gb.cfg.MastodonUserPassword)
+	return nil
+}
+
+// Posts the toot to every notifier, attaching the image if there is one. Notifiers
+// that understand events get the event instead, if there is one, and notifiers
+// that can reply post it as a reply to their status in inReplyTo. If edit is set,
+// notifiers that can edit replace their status in inReplyTo with it instead.
+// Returns the IDs of the statuses it was posted as, the number of notifiers it was
+// posted to, and an error for each that failed.
+func (gb *GridBot) sendToot(toot string, image []byte, event *PeakEvent, inReplyTo StatusIDs, edit string) (StatusIDs, int, error) {
+	if len(gb.notifiers) == 0 {
+		return nil, 0, fmt.Errorf("no notifiers configured")
+	}
+	var errs []error
+	var altText string
+	if event != nil {
+		altText = event.ImageDescription
+	}
+	ids := make(StatusIDs)
+	posted := 0
+	for _, n := range gb.notifiers {
+		var err error
+		if en, ok := n.(EventNotifier); ok && event != nil {
+			err = en.NotifyEvent(*event, image)
+		} else if en, ok := n.(EditNotifier); ok && edit != "" && image != nil && inReplyTo[n.Name()] != "" {
+			err = en.EditStatusWithImageFromReader(inReplyTo[n.Name()], edit, bytes.NewReader(image), altText)
+		} else if image == nil {
+			err = n.PostStatus(toot)
+		} else {
+			var id string
+			if rn, ok := n.(ReplyNotifier); ok && inReplyTo[n.Name()] != "" {
+				id, err = rn.PostReplyWithImageFromReader(toot, bytes.NewReader(image), altText, gb.cfg.Visibility, inReplyTo[n.Name()])
+			} else {
+				id, err = n.PostStatusWithImageFromReader(toot, bytes.NewReader(image), altText, gb.cfg.Visibility)
+			}
+			if err == nil && id != "" {
+				ids[n.Name()] = id
+			}
+		}
 		if err != nil {
-			return fmt.Errorf("failed to connect to mastodon: %s", err)
+			tootsFailed.WithLabelValues(string(gb.cfg.RegionID), n.Name()).Inc()
+			errs = append(errs, fmt.Errorf("failed to post to %s: %s", n.Name(), err))
+			continue
 		}
+		tootsSent.WithLabelValues(string(gb.cfg.RegionID), n.Name()).Inc()
+		posted++
+		slog.Info("Tooted", "notifier", n.Name(), "toot", toot)
 	}
-	if reader == nil {
-		err = gb.m.PostStatus(toot)
-	} else {
-		err = gb.m.PostStatusWithImageFromReader(toot, reader, "public")
+	return ids, posted, errors.Join(errs...)
+}
+
+// Restores the last tooted peak from the state store, if there is one. Returns
+// true if any state was loaded.
+func (gb *GridBot) loadState() bool {
+	if gb.cfg.StateStore == nil {
+		return false
 	}
-	if err != nil {
-		gb.m = nil
-		return fmt.Errorf("failed to toot: %s", err)
+	state, err := gb.cfg.StateStore.Load(gb.cfg.RegionID)
+	if errors.Is(err, ErrNoState) {
+		return false
+	} else if err != nil {
+		slog.Error("Failed to load state", "region", gb.regionString, "err", err)
+		return false
 	}
+	gb.lastTootedPeakRRP = state.LastTootedPeakRRP
+	gb.lastTootedPeakTime = state.LastTootedPeakTime
+	gb.lastTootedPeakIDs = state.LastTootedPeakStatusIDs
+	gb.tootedPeaks = state.LastTootedPeaks
+	gb.restoreTootedPeaks()
+	gb.pendingOutcomes = state.PendingOutcomes
+	gb.lastTootedTrough = state.LastTootedTrough
+	gb.lastToot = state.LastToot
+	slog.Info("Loaded state", "region", gb.regionString, "lastTootedPeakRRP", gb.lastTootedPeakRRP, "lastTootedPeakTime", gb.lastTootedPeakTime)
+	return true
+}
 
-	slog.Info("Tooted", "toot", toot)
-	return nil
+// State saved before we tracked each peak window separately, or recovered from
+// the timeline, only has the last peak. If that peak is still on, treat it as a
+// window of its own.
+func (gb *GridBot) restoreTootedPeaks() {
+	if len(gb.tootedPeaks) > 0 || gb.lastTootedPeakRRP <= gb.cfg.PeakExitRRP {
+		return
+	}
+	gb.tootedPeaks = []TootedPeak{{
+		PriceWindow: PriceWindow{
+			Start:      gb.lastTootedPeakTime.Add(-FORECAST_INTERVAL_LENGTH),
+			End:        gb.lastTootedPeakTime,
+			RRP:        gb.lastTootedPeakRRP,
+			RRPTime:    gb.lastTootedPeakTime,
+			AverageRRP: gb.lastTootedPeakRRP,
+		},
+		StatusIDs: gb.lastTootedPeakIDs,
+	}}
+}
+
+func (gb *GridBot) saveState() {
+	if gb.cfg.StateStore == nil {
+		return
+	}
+	state := GridBotState{
+		LastTootedPeakRRP:       gb.lastTootedPeakRRP,
+		LastTootedPeakTime:      gb.lastTootedPeakTime,
+		LastTootedPeakStatusIDs: gb.lastTootedPeakIDs,
+		LastTootedPeaks:         gb.tootedPeaks,
+		PendingOutcomes:         gb.pendingOutcomes,
+		LastTootedTrough:        gb.lastTootedTrough,
+		LastToot:                gb.lastToot,
+	}
+	if err := gb.cfg.StateStore.Save(gb.cfg.RegionID, state); err != nil {
+		slog.Error("Failed to save state", "region", gb.regionString, "err", err)
+	}
 }
 
 // This is a goroutine that listens for toots from me (@tj@howse.social) and
@@ -170,70 +372,352 @@ func (gb *GridBot) resetIntervalChannel() {
 
 func (gb *GridBot) Mainloop() {
 	slog.Info("Launching gridbot", "region", gb.regionString)
+	if !gb.stateRestored {
+		gb.recoverStateFromTimeline()
+	}
 	for {
 		for i := range gb.input {
 			gb.processInterval(i)
 			slog.Debug("Processed interval", "rrp", i.RRP, "time", i.SettlementDate.Time)
 		}
 		gb.considerPostingToot()
+		gb.considerPostingTroughToot()
+		gb.considerPostingOutcomes()
+		gb.updateStatus()
+		gb.updateMetrics()
 		gb.resetIntervalChannel()
 	}
 }
 
-func (gb *GridBot) generatePlot(writer io.Writer) {
-	labels := make([]time.Time, 0)
-	values := make([]float64, 0)
+// Copies the current forecast and peak into the status, unless this batch didn't
+// bring any new forecasts with it.
+func (gb *GridBot) updateStatus() {
+	if gb.forecastsStale {
+		return
+	}
+	forecasts := make([]Interval, len(gb.forecasts))
+	copy(forecasts, gb.forecasts)
+	now := time.Now()
+	actuals := gb.actualsBetween(now.Add(-PLOT_ACTUALS_HISTORY), now)
+
+	gb.statusMu.Lock()
+	defer gb.statusMu.Unlock()
+	gb.status.Forecasts = forecasts
+	gb.status.Actuals = actuals
+	gb.status.PeakRRP = gb.peakRRP
+	gb.status.PeakTime = gb.peakTime
+	gb.status.PeakWindows = gb.findPeakWindows()
+	gb.status.LastTootedPeakRRP = gb.lastTootedPeakRRP
+	gb.status.LastTootedPeakTime = gb.lastTootedPeakTime
+	gb.status.UpdatedAt = now
+}
+
+// Returns the GridBot's status. This is safe to call while Mainloop is running.
+func (gb *GridBot) Status() GridBotStatus {
+	gb.statusMu.RLock()
+	defer gb.statusMu.RUnlock()
+	return gb.status
+}
 
-	for _, i := range gb.forecasts {
-		labels = append(labels, i.SettlementDate.Time)
-		values = append(values, i.RRP)
+// Returns the time of day in the region's local time, for toots.
+func (gb *GridBot) clock(t time.Time) string {
+	return t.In(gb.location).Format("15:04")
+}
+
+func (gb *GridBot) generatePlot(writer io.Writer) error {
+	now := time.Now()
+	return PlotPrices(gb.pricePlot(gb.forecasts, gb.actualsBetween(now.Add(-PLOT_ACTUALS_HISTORY), now), gb.findPeakWindows(), now), gb.plotOptions(), writer)
+}
+
+// The options for the plots attached to toots.
+func (gb *GridBot) plotOptions() PlotOptions {
+	return PlotOptions{Format: PLOT_FORMAT_PNG, Theme: gb.cfg.PlotTheme, Units: gb.cfg.Templates.Units}
+}
+
+// Lays out the plot of the forecasts and the actuals from the PLOT_ACTUALS_HISTORY
+// before now, with the peak windows in the forecast marked, and their demand if
+// the GridBot's set up to plot it. This only uses the GridBot's config, so it's
+// safe to call with a status while Mainloop is running.
+func (gb *GridBot) pricePlot(forecasts, actuals []Interval, peaks []PriceWindow, now time.Time) PricePlot {
+	pp := PricePlot{
+		Now:       now,
+		Threshold: gb.cfg.PeakEnterRRP,
+		Peaks:     peaks,
+		Location:  gb.location,
+	}
+	demand := func(i Interval) {
+		if gb.cfg.PlotDemand {
+			pp.Demand = append(pp.Demand, DemandPoint{
+				Time:          i.SettlementDate.Time,
+				Demand:        i.TotalDemand,
+				Scheduled:     i.ScheduledGeneration,
+				SemiScheduled: i.SemiScheduledGeneration,
+				Interchange:   i.NetInterchange,
+			})
+		}
+	}
+	for _, i := range actuals {
+		if i.SettlementDate.After(now.Add(-PLOT_ACTUALS_HISTORY)) {
+			pp.Actual = append(pp.Actual, ForecastPoint{Time: i.SettlementDate.Time, RRP: i.RRP})
+			demand(i)
+		}
+	}
+	for _, i := range forecasts {
+		pp.Forecast = append(pp.Forecast, ForecastPoint{Time: i.SettlementDate.Time, RRP: i.RRP})
+		demand(i)
+	}
+	return pp
+}
+
+// Returns true if a price is the same as, or uninterestingly close to, the one
+// we last tooted about, for the same time.
+func (gb *GridBot) alreadyTooted(rrp, lastTootedRRP float64, sameTime bool) bool {
+	if !sameTime {
+		return false
+	}
+	// We've already tooted about this one.
+	if FloatEquals(lastTootedRRP, rrp) {
+		return true
 	}
+	// If the change in RRP is uninterestingly small, ignore it.
+	return math.Abs(rrp-lastTootedRRP) < gb.cfg.PeakDeltaRRP
+}
 
-	GetPlot(labels, values, writer)
+// Finds the windows of forecast prices above the exit threshold. Once we've
+// tooted about a peak its window lasts until prices drop below the exit
+// threshold, so a forecast hovering around the enter threshold doesn't have us
+// tooting and cancelling over and over.
+func (gb *GridBot) findPeakWindows() []PriceWindow {
+	return findWindows(gb.forecasts, func(rrp float64) bool { return rrp > gb.cfg.PeakExitRRP }, func(a, b float64) bool { return a > b })
 }
 
+// Toots about each peak window in the forecast that's new or has changed, and
+// about each one we've tooted about that's gone from the forecast. Each window
+// is tracked separately, so a second evening peak still gets a toot even if the
+// afternoon one is higher.
+//
+// The forecast only covers what's still to come, so once a window we've tooted
+// about is underway all the forecast has of it is what's left. The part that's
+// been and gone is kept as we tooted it, and only what's left is compared with
+// the forecast. It's too late to cancel a window that's underway, so it's kept
+// until it's over to be followed up.
 func (gb *GridBot) considerPostingToot() {
-	// We've already tooted about this peak.
-	if FloatEquals(gb.lastTootedPeakRRP, gb.peakRRP) && gb.lastTootedPeakTime.Equal(gb.peakTime) {
+	// If nothing new came in there's nothing to go on.
+	if gb.forecastsStale {
 		return
 	}
+	now := gb.now()
+
+	// Windows that have been and gone don't need updating or cancelling, just
+	// following up once we know how they turned out.
+	tooted := make([]TootedPeak, 0, len(gb.tootedPeaks))
+	changed := false
+	for _, w := range gb.tootedPeaks {
+		if !w.End.Before(now) {
+			tooted = append(tooted, w)
+		} else if w.Forecast != nil {
+			gb.pendingOutcomes = append(gb.pendingOutcomes, w)
+			changed = true
+		}
+	}
+	claimed := make([]bool, len(tooted))
+
+	gb.tootedPeaks = make([]TootedPeak, 0)
+	for _, w := range gb.findPeakWindows() {
+		// Match the window up with the one we tooted about for the same stretch of time.
+		previous := -1
+		for n, t := range tooted {
+			if !claimed[n] && t.Overlaps(w) && (previous == -1 || t.RRP > tooted[previous].RRP) {
+				previous = n
+			}
+		}
+		if previous == -1 {
+			if w.RRP > gb.cfg.PeakEnterRRP {
+				gb.tootedPeaks = append(gb.tootedPeaks, gb.tootPeakWindow(w, TootedPeak{}))
+				changed = true
+			}
+			continue
+		}
+		claimed[previous] = true
+		// Any others it overlaps have merged into it.
+		for n, t := range tooted {
+			if t.Overlaps(w) {
+				claimed[n] = true
+			}
+		}
+		last := tooted[previous]
+		start := w.Start
+		if last.Start.Before(now) && last.Start.Before(start) {
+			start = last.Start
+		}
+		quiet := gb.alreadyTooted(w.RRP, last.RRP, last.RRPTime.Equal(w.RRPTime))
+		if last.RRPTime.Add(-FORECAST_INTERVAL_LENGTH).Before(now) {
+			// The peak we tooted about has already started, so what's left of
+			// the window is only worth a toot if it has a new, higher peak.
+			quiet = w.RRP <= last.RRP || gb.alreadyTooted(w.RRP, last.RRP, true)
+		}
+		if quiet {
+			// Keep what we tooted, but follow the window as it moves.
+			last.Start, last.End = start, w.End
+			gb.tootedPeaks = append(gb.tootedPeaks, last)
+			continue
+		}
+		peak := gb.tootPeakWindow(w, last)
+		peak.Start = start
+		// Hang on to what was forecast for the part that's passed too, for the follow up.
+		if len(peak.Forecast) > 0 {
+			passed := 0
+			for passed < len(last.Forecast) && last.Forecast[passed].Time.Before(peak.Forecast[0].Time) {
+				passed++
+			}
+			peak.Forecast = append(append([]ForecastPoint{}, last.Forecast[:passed]...), peak.Forecast...)
+		}
+		gb.tootedPeaks = append(gb.tootedPeaks, peak)
+		changed = true
+	}
 
-	// If the change in peak RRP is uninterestingly small, ignore it.
-	if math.Abs(gb.peakRRP-gb.lastTootedPeakRRP) < UNINTERESTING_DELTA_RRP && gb.lastTootedPeakTime.Equal(gb.peakTime) {
-		return
+	for n, t := range tooted {
+		if claimed[n] {
+			continue
+		}
+		if t.Start.Before(now) {
+			gb.tootedPeaks = append(gb.tootedPeaks, t)
+			continue
+		}
+		gb.tootPeakCancelled(t)
+		changed = true
+	}
+	// The toots saved the state as they went, but not the windows they were about.
+	if changed {
+		gb.saveState()
 	}
+}
 
+// Toots about a new peak window, or a change to the last one we tooted about, and
+// returns what we tooted. A change is a reply to the toot announcing the window,
+// so each window's toots form a thread.
+func (gb *GridBot) tootPeakWindow(w PriceWindow, last TootedPeak) TootedPeak {
 	var toot string
-	if gb.peakRRP < INTERESTING_PEAK_RRP && gb.lastTootedPeakRRP > INTERESTING_PEAK_RRP {
-		// If the new peak is below INTERESTING_PEAK_RRP but the previous peak was above, publish a
-		// retraction saying the peak was cancelled.
-		toot = fmt.Sprintf(PEAK_CANCELLED_TOOT_FORMAT, gb.regionString, gb.lastTootedPeakRRP/1000, gb.lastTootedPeakTime.Format("15:04"))
-	} else if gb.peakRRP > INTERESTING_PEAK_RRP {
-		// If the peak is interesting...
-		if gb.peakRRP > gb.lastTootedPeakRRP {
-			// If it's bigger than the last peak, toot about it.
-			toot = fmt.Sprintf(PEAK_TOOT_FORMAT, gb.regionString, gb.peakRRP/1000, gb.peakTime.Format("15:04"))
-		} else {
-			// If it's smaller than the last peak, toot about the downgrade.
-			toot = fmt.Sprintf(PEAK_DOWNGRADE_TOOT_FORMAT, gb.regionString, gb.lastTootedPeakRRP/1000, gb.peakRRP/1000, gb.peakTime.Format("15:04"))
-		}
+	event := PeakEvent{
+		RegionID:    gb.cfg.RegionID,
+		RRP:         w.RRP,
+		PreviousRRP: last.RRP,
+		PeakTime:    w.RRPTime,
+		AverageRRP:  w.AverageRRP,
+		WindowStart: &w.Start,
+		WindowEnd:   &w.End,
+	}
+	if w.RRP > last.RRP {
+		// If it's bigger than the last peak, toot about it.
+		toot = gb.formatPeakToot(gb.cfg.Templates.Peak, defaultTootTemplates.Peak, w, last.RRP)
+		event.Type = PeakEventPeak
 	} else {
-		return
+		// If it's smaller than the last peak, toot about the downgrade.
+		toot = gb.formatPeakToot(gb.cfg.Templates.Downgrade, defaultTootTemplates.Downgrade, w, last.RRP)
+		event.Type = PeakEventDowngrade
+	}
+	gb.lastTootedPeakRRP = w.RRP
+	gb.lastTootedPeakTime = w.RRPTime
+	var edit string
+	if event.Type == PeakEventDowngrade && gb.cfg.DowngradeMode == DOWNGRADE_MODE_EDIT {
+		// Revise the announcement rather than adding to the thread.
+		edit = gb.formatPeakToot(gb.cfg.Templates.Peak, defaultTootTemplates.Peak, w, last.RRP) +
+			fmt.Sprintf(PEAK_REVISED_NOTE_FORMAT, gb.clock(time.Now()))
+	}
+	posted := gb.postEvent(toot, event, last.StatusIDs, edit)
+	// The first toot about a window starts its thread.
+	ids := last.StatusIDs
+	if len(ids) == 0 {
+		ids = posted
+	}
+	gb.lastTootedPeakIDs = ids
+	return TootedPeak{PriceWindow: w, Forecast: gb.forecastPoints(), StatusIDs: ids}
+}
+
+// Publishes a retraction saying the peak was cancelled, as a reply to the toot
+// announcing it.
+func (gb *GridBot) tootPeakCancelled(last TootedPeak) {
+	// It's still the cancelled peak, just with the price that's forecast now.
+	cancelled := last.PriceWindow
+	cancelled.RRP = gb.forecastPeakDuring(last.PriceWindow)
+	toot := gb.formatPeakToot(gb.cfg.Templates.Cancelled, defaultTootTemplates.Cancelled, cancelled, last.RRP)
+	event := PeakEvent{
+		Type:        PeakEventCancelled,
+		RegionID:    gb.cfg.RegionID,
+		RRP:         cancelled.RRP,
+		PreviousRRP: last.RRP,
+		PeakTime:    last.RRPTime,
+		WindowStart: &last.Start,
+		WindowEnd:   &last.End,
+	}
+	gb.lastTootedPeakRRP = cancelled.RRP
+	gb.lastTootedPeakTime = last.RRPTime
+	gb.lastTootedPeakIDs = nil
+	gb.postEvent(toot, event, last.StatusIDs, "")
+}
+
+// Returns the highest price now forecast over w. If nothing's forecast over it
+// any more, all we know is the price is no longer above the exit threshold.
+func (gb *GridBot) forecastPeakDuring(w PriceWindow) float64 {
+	rrp, found := 0.0, false
+	for _, i := range gb.forecasts {
+		if !i.SettlementDate.After(w.Start) || i.SettlementDate.After(w.End) {
+			continue
+		}
+		if !found || i.RRP > rrp {
+			rrp, found = i.RRP, true
+		}
+	}
+	if !found {
+		return math.Min(w.RRP, gb.cfg.PeakExitRRP)
+	}
+	return rrp
+}
+
+// Returns the current forecast prices.
+func (gb *GridBot) forecastPoints() []ForecastPoint {
+	points := make([]ForecastPoint, 0, len(gb.forecasts))
+	for _, i := range gb.forecasts {
+		points = append(points, ForecastPoint{Time: i.SettlementDate.Time, RRP: i.RRP})
 	}
+	return points
+}
+
+// Toots about an event with a plot of the forecast attached, as a reply to the
+// statuses in inReplyTo if there are any, and saves the state if it went out.
+// See sendToot for edit. Returns the IDs of the statuses it was posted as.
+func (gb *GridBot) postEvent(toot string, event PeakEvent, inReplyTo StatusIDs, edit string) StatusIDs {
+	event.Forecast = gb.forecastPoints()
+	event.ImageDescription = DescribePrices("forecast wholesale electricity prices", event.Forecast, gb.location, gb.cfg.Templates.Units)
 
 	buffer := new(bytes.Buffer)
-	gb.generatePlot(buffer)
+	if err := gb.generatePlot(buffer); err != nil {
+		slog.Error("Failed to plot forecast", "region", gb.regionString, "err", err)
+	}
+
+	return gb.postEventWithImage(toot, event, buffer.Bytes(), inReplyTo, edit)
+}
+
+// Toots about an event with the image attached, as a reply to the statuses in
+// inReplyTo if there are any, and saves the state if it went out. Returns the
+// IDs of the statuses it was posted as.
+func (gb *GridBot) postEventWithImage(toot string, event PeakEvent, image []byte, inReplyTo StatusIDs, edit string) StatusIDs {
+	event.Message = toot
 
 	slog.Info("Toot!", "toot", toot)
 
-	gb.lastTootedPeakRRP = gb.peakRRP
-	gb.lastTootedPeakTime = gb.peakTime
 	gb.lastToot = toot
 
 	// Toot it
-	if err := gb.sendToot(toot, buffer); err != nil {
-		slog.Error("Failed to send toot:", err)
+	ids, posted, err := gb.sendToot(toot, image, &event, inReplyTo, edit)
+	if err != nil {
+		slog.Error("Failed to send toot", "err", err)
 	}
+	// As long as it went out somewhere, remember that we've tooted it.
+	if posted > 0 {
+		gb.saveState()
+	}
+	return ids
 }
 
 func (gb *GridBot) processInterval(i Interval) {
@@ -242,6 +726,16 @@ func (gb *GridBot) processInterval(i Interval) {
 		return
 	}
 
+	for _, n := range gb.notifiers {
+		if o, ok := n.(IntervalObserver); ok {
+			o.ObserveInterval(i)
+		}
+	}
+
+	if i.PeriodType == "ACTUAL" {
+		gb.recordActual(i)
+	}
+
 	// Ignore data that isn't a forecast
 	if i.PeriodType != "FORECAST" {
 		return
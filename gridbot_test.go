@@ -1,13 +1,133 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
 	"testing"
 	"time"
 )
 
+type fakePost struct {
+	status     string
+	image      []byte
+	altText    string
+	visibility string
+}
+
+// fakeNotifier hands everything posted to it to a channel, so tests can wait on
+// toots rather than polling lastToot.
+type fakeNotifier struct {
+	posts chan fakePost
+	err   error
+}
+
+func newFakeNotifier() *fakeNotifier {
+	return &fakeNotifier{posts: make(chan fakePost, 10)}
+}
+
+func (n *fakeNotifier) Name() string {
+	return "fake"
+}
+
+func (n *fakeNotifier) PostStatus(status string) error {
+	n.posts <- fakePost{status: status}
+	return n.err
+}
+
+func (n *fakeNotifier) PostStatusWithImageFromReader(status string, file io.Reader, altText string, visibility string) (string, error) {
+	image, err := io.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
+	n.posts <- fakePost{status: status, image: image, altText: altText, visibility: visibility}
+	return "", n.err
+}
+
+func (n *fakeNotifier) waitForPost(t *testing.T) fakePost {
+	select {
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a post")
+	case p := <-n.posts:
+		return p
+	}
+	return fakePost{}
+}
+
+// fakeEventNotifier is a fakeNotifier that takes PeakEvents too.
+type fakeEventNotifier struct {
+	*fakeNotifier
+	events chan PeakEvent
+}
+
+func newFakeEventNotifier() *fakeEventNotifier {
+	return &fakeEventNotifier{fakeNotifier: newFakeNotifier(), events: make(chan PeakEvent, 10)}
+}
+
+func (n *fakeEventNotifier) NotifyEvent(e PeakEvent, image []byte) error {
+	n.events <- e
+	return n.err
+}
+
+func (n *fakeEventNotifier) waitForEvent(t *testing.T) PeakEvent {
+	select {
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for an event")
+	case e := <-n.events:
+		return e
+	}
+	return PeakEvent{}
+}
+
+// fakeReplyNotifier is a fakeNotifier that can post replies, numbering its
+// statuses from 1.
+type fakeReplyNotifier struct {
+	*fakeNotifier
+	inReplyTo chan string
+	lastID    int
+}
+
+func newFakeReplyNotifier() *fakeReplyNotifier {
+	return &fakeReplyNotifier{fakeNotifier: newFakeNotifier(), inReplyTo: make(chan string, 10)}
+}
+
+func (n *fakeReplyNotifier) PostStatusWithImageFromReader(status string, file io.Reader, altText string, visibility string) (string, error) {
+	return n.PostReplyWithImageFromReader(status, file, altText, visibility, "")
+}
+
+func (n *fakeReplyNotifier) PostReplyWithImageFromReader(status string, file io.Reader, altText string, visibility string, inReplyToID string) (string, error) {
+	if _, err := n.fakeNotifier.PostStatusWithImageFromReader(status, file, altText, visibility); err != nil {
+		return "", err
+	}
+	n.inReplyTo <- inReplyToID
+	n.lastID++
+	return strconv.Itoa(n.lastID), nil
+}
+
+// fakeEditNotifier is a fakeReplyNotifier that can edit its statuses too.
+type fakeEditNotifier struct {
+	*fakeReplyNotifier
+	edits chan fakeEdit
+}
+
+type fakeEdit struct {
+	id     string
+	status string
+}
+
+func newFakeEditNotifier() *fakeEditNotifier {
+	return &fakeEditNotifier{fakeReplyNotifier: newFakeReplyNotifier(), edits: make(chan fakeEdit, 10)}
+}
+
+func (n *fakeEditNotifier) EditStatusWithImageFromReader(id string, status string, file io.Reader, altText string) error {
+	n.edits <- fakeEdit{id: id, status: status}
+	return n.err
+}
+
 func ValidateToot(gridBot *GridBot, intervalRRP float64, intervalTime time.Time, expectedToot string, t *testing.T) {
 
 	if want, got := intervalRRP, gridBot.lastTootedPeakRRP; !FloatEquals(want, got) {
@@ -48,14 +168,43 @@ const (
 	CANCELLED
 )
 
-func FormatExpectedToot(intervalRRP float64, intervalTime time.Time, region string, oldPeakIntervalRRP float64, peak peakType) string {
+// Returns a forecast interval for each price, half an hour apart, the first ending
+// half an hour after start.
+func NewForecastRun(regionID RegionID, start time.Time, rrps ...float64) []Interval {
+	forecasts := make([]Interval, 0, len(rrps))
+	for n, rrp := range rrps {
+		t := start.Add(time.Duration(n+1) * FORECAST_INTERVAL_LENGTH)
+		forecasts = append(forecasts, Interval{SettlementDate: JSONTime{t}, RegionID: regionID, Region: string(regionID), PeriodType: "FORECAST", RRP: rrp})
+	}
+	return forecasts
+}
+
+// The window a peak of a single forecast interval makes.
+func OneIntervalWindow(intervalRRP float64, intervalTime time.Time) PriceWindow {
+	return PriceWindow{
+		Start:      intervalTime.Add(-FORECAST_INTERVAL_LENGTH),
+		End:        intervalTime,
+		RRP:        intervalRRP,
+		RRPTime:    intervalTime,
+		AverageRRP: intervalRRP,
+	}
+}
+
+func FormatExpectedToot(intervalRRP float64, intervalTime time.Time, region string, oldPeakIntervalRRP float64, peak peakType, window PriceWindow) string {
+	// Toots show times in the region's local time.
+	clock := func(t time.Time) string {
+		if location, err := RegionLocation("QLD1"); err == nil {
+			t = t.In(location)
+		}
+		return t.Format("15:04")
+	}
 	switch peak {
 	case PEAK:
-		return fmt.Sprintf(PEAK_TOOT_FORMAT, "Queensland", intervalRRP/1000, intervalTime.Format("15:04"))
+		return fmt.Sprintf(PEAK_TOOT_FORMAT, "Queensland", intervalRRP/1000, clock(intervalTime), window.AverageRRP/1000, clock(window.Start), clock(window.End))
 	case DOWNGRADE:
-		return fmt.Sprintf(PEAK_DOWNGRADE_TOOT_FORMAT, "Queensland", oldPeakIntervalRRP/1000, intervalRRP/1000, intervalTime.Format("15:04"))
+		return fmt.Sprintf(PEAK_DOWNGRADE_TOOT_FORMAT, "Queensland", oldPeakIntervalRRP/1000, intervalRRP/1000, clock(intervalTime), window.AverageRRP/1000, clock(window.Start), clock(window.End))
 	case CANCELLED:
-		return fmt.Sprintf(PEAK_CANCELLED_TOOT_FORMAT, "Queensland", intervalRRP/1000, intervalTime.Format("15:04"))
+		return fmt.Sprintf(PEAK_CANCELLED_TOOT_FORMAT, "Queensland", intervalRRP/1000, clock(intervalTime))
 	}
 	return ""
 }
@@ -123,7 +272,7 @@ func TestGridBotBasicInterval(t *testing.T) {
 		t.Errorf("Expected forecastsStale to be false, got true")
 	}
 	CommitIntervals(gridBot, t)
-	ValidateToot(gridBot, peakRRP, peakTime, FormatExpectedToot(peakRRP, peakTime, "Queensland", 0, PEAK), t)
+	ValidateToot(gridBot, peakRRP, peakTime, FormatExpectedToot(peakRRP, peakTime, "Queensland", 0, PEAK, OneIntervalWindow(peakRRP, peakTime)), t)
 	if want, got := 1, len(gridBot.forecasts); want != got {
 		t.Errorf("Expected %d, got %d", want, got)
 	}
@@ -151,17 +300,19 @@ func TestGridBotBasicPeak(t *testing.T) {
 	peakTime := time.Now().Add(2 * time.Hour)
 	peakRRP := float64(INTERESTING_PEAK_RRP * 3)
 
-	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP/2, peakTime.Add(-1*time.Hour), t)
+	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP/2, peakTime.Add(-FORECAST_INTERVAL_LENGTH), t)
 	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP, peakTime, t)
-	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP/2, peakTime.Add(1*time.Hour), t)
+	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP/2, peakTime.Add(FORECAST_INTERVAL_LENGTH), t)
 	if want, got := 3, len(gridBot.forecasts); want != got {
 		t.Errorf("Expected %d, got %d", want, got)
 	}
 	if gridBot.forecastsStale {
 		t.Errorf("Expected forecastsStale to be false, got true")
 	}
+	// All three intervals are above the threshold.
+	window := PriceWindow{Start: peakTime.Add(-2 * FORECAST_INTERVAL_LENGTH), End: peakTime.Add(FORECAST_INTERVAL_LENGTH), AverageRRP: peakRRP * 2 / 3}
 	CommitIntervals(gridBot, t)
-	ValidateToot(gridBot, peakRRP, peakTime, FormatExpectedToot(peakRRP, peakTime, "Queensland", 0, PEAK), t)
+	ValidateToot(gridBot, peakRRP, peakTime, FormatExpectedToot(peakRRP, peakTime, "Queensland", 0, PEAK, window), t)
 	if !gridBot.forecastsStale {
 		t.Errorf("Expected forecastsStale to be true, got false")
 	}
@@ -169,39 +320,39 @@ func TestGridBotBasicPeak(t *testing.T) {
 	oldPeak := peakRRP
 	// Cancel the peak
 	peakRRP = float64(INTERESTING_PEAK_RRP - 1)
-	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP/2, peakTime.Add(-1*time.Hour), t)
+	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP/2, peakTime.Add(-FORECAST_INTERVAL_LENGTH), t)
 	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP, peakTime, t)
-	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP/2, peakTime.Add(1*time.Hour), t)
+	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP/2, peakTime.Add(FORECAST_INTERVAL_LENGTH), t)
 	if gridBot.forecastsStale {
 		t.Errorf("Expected forecastsStale to be false, got true")
 	}
 	CommitIntervals(gridBot, t)
-	ValidateToot(gridBot, peakRRP, peakTime, FormatExpectedToot(oldPeak, peakTime, "Queensland", 0, CANCELLED), t)
+	ValidateToot(gridBot, peakRRP, peakTime, FormatExpectedToot(oldPeak, peakTime, "Queensland", 0, CANCELLED, PriceWindow{}), t)
 	if want, got := 3, len(gridBot.forecasts); want != got {
 		t.Errorf("Expected %d, got %d", want, got)
 	}
 
 	// Restore the peak
 	peakRRP = float64(INTERESTING_PEAK_RRP * 3)
-	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP/2, peakTime.Add(-1*time.Hour), t)
+	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP/2, peakTime.Add(-FORECAST_INTERVAL_LENGTH), t)
 	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP, peakTime, t)
-	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP/2, peakTime.Add(1*time.Hour), t)
+	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP/2, peakTime.Add(FORECAST_INTERVAL_LENGTH), t)
 	CommitIntervals(gridBot, t)
-	ValidateToot(gridBot, peakRRP, peakTime, FormatExpectedToot(peakRRP, peakTime, "Queensland", 0, PEAK), t)
+	ValidateToot(gridBot, peakRRP, peakTime, FormatExpectedToot(peakRRP, peakTime, "Queensland", 0, PEAK, window), t)
 
 	// Lower peak
 	peakRRP = float64(INTERESTING_PEAK_RRP * 2)
-	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP/2, peakTime.Add(-1*time.Hour), t)
+	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP/2, peakTime.Add(-FORECAST_INTERVAL_LENGTH), t)
 	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP, peakTime, t)
-	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP/2, peakTime.Add(1*time.Hour), t)
+	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP/2, peakTime.Add(FORECAST_INTERVAL_LENGTH), t)
 	CommitIntervals(gridBot, t)
-	ValidateToot(gridBot, peakRRP, peakTime, FormatExpectedToot(peakRRP, peakTime, "Queensland", oldPeak, DOWNGRADE), t)
+	ValidateToot(gridBot, peakRRP, peakTime, FormatExpectedToot(peakRRP, peakTime, "Queensland", oldPeak, DOWNGRADE, OneIntervalWindow(peakRRP, peakTime)), t)
 
 	// Marginally larger peak, should be ignored.
 	peakRRP = float64(INTERESTING_PEAK_RRP*2 + 10)
-	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP/2, peakTime.Add(-1*time.Hour), t)
+	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP/2, peakTime.Add(-FORECAST_INTERVAL_LENGTH), t)
 	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP, peakTime, t)
-	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP/2, peakTime.Add(1*time.Hour), t)
+	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP/2, peakTime.Add(FORECAST_INTERVAL_LENGTH), t)
 
 	// Can't use the ValidateToot helper here, since it waits for the lastToot to be != "", but that's
 	// exactly what we want in this case. Just close off the channel and wait a second.
@@ -212,6 +363,46 @@ func TestGridBotBasicPeak(t *testing.T) {
 	}
 }
 
+func TestGridBotNotifiers(t *testing.T) {
+	cfg := GridBotCfg{}
+	cfg.TestMode = true
+	cfg.RegionID = "QLD1"
+	cfg.Visibility = "unlisted"
+
+	var gridBot *GridBot
+	var err error
+
+	if gridBot, err = NewGridBot(cfg); err != nil {
+		t.Fatal(err)
+	}
+	working := newFakeNotifier()
+	broken := newFakeNotifier()
+	broken.err = errors.New("server on fire")
+	gridBot.AddNotifier(broken)
+	gridBot.AddNotifier(working)
+
+	go gridBot.Mainloop()
+
+	peakTime := time.Now().Add(2 * time.Hour)
+	peakRRP := float64(INTERESTING_PEAK_RRP * 3)
+	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP, peakTime, t)
+	close(gridBot.GetIntervalChannel())
+
+	// A broken notifier shouldn't stop the others from getting the toot.
+	for _, n := range []*fakeNotifier{broken, working} {
+		post := n.waitForPost(t)
+		if want, got := FormatExpectedToot(peakRRP, peakTime, "Queensland", 0, PEAK, OneIntervalWindow(peakRRP, peakTime)), post.status; want != got {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+		if len(post.image) == 0 {
+			t.Errorf("Expected a plot to be attached")
+		}
+		if want, got := "unlisted", post.visibility; want != got {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+	}
+}
+
 func TestBuildBasicGridBot(t *testing.T) {
 	cfg := config{}
 	cfg.GridBotCredentials = `[
@@ -310,6 +501,250 @@ func TestBuildBasicGridBots(t *testing.T) {
 	}
 }
 
+func TestBuildGridBotNotifiers(t *testing.T) {
+	cfg := config{}
+	cfg.GridBotCredentials = `[
+		{
+			"RegionID": "QLD1",
+			"TelegramBotToken": "token",
+			"TelegramChatID": "-100123"
+		},
+		{
+			"RegionID": "NSW1",
+			"DiscordWebhookURL": "https://discord.com/api/webhooks/1/abc",
+			"Webhooks": [{"URL": "https://example.com/hook", "Secret": "secret"}]
+		}
+	]`
+
+	gridBots, err := BuildGridBots(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for regionID, want := range map[RegionID][]string{
+		"QLD1": {"telegram"},
+		"NSW1": {"discord", "webhook"},
+	} {
+		var got []string
+		for _, n := range gridBots[regionID].notifiers {
+			got = append(got, n.Name())
+		}
+		if fmt.Sprint(want) != fmt.Sprint(got) {
+			t.Errorf("Expected %s notifiers %v, got %v", regionID, want, got)
+		}
+	}
+}
+
+func TestGridBotPeakHysteresis(t *testing.T) {
+	cfg := GridBotCfg{RegionID: "SA1", TestMode: true, PeakEnterRRP: 500, PeakExitRRP: 300}
+	gridBot, err := NewGridBot(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := float64(UNINTERESTING_DELTA_RRP), gridBot.cfg.PeakDeltaRRP; !FloatEquals(want, got) {
+		t.Errorf("Expected %f, got %f", want, got)
+	}
+
+	peakTime := time.Now().Add(2 * time.Hour).Truncate(time.Minute)
+	clock := gridBot.clock(peakTime)
+	start := gridBot.clock(peakTime.Add(-FORECAST_INTERVAL_LENGTH))
+	for _, step := range []struct {
+		rrp  float64
+		toot string // Blank if it shouldn't toot.
+	}{
+		{600, fmt.Sprintf(PEAK_TOOT_FORMAT, "South Australia", 0.6, clock, 0.6, start, clock)},
+		// Below the enter threshold but above the exit threshold, so it's only a downgrade.
+		{450, fmt.Sprintf(PEAK_DOWNGRADE_TOOT_FORMAT, "South Australia", 0.6, 0.45, clock, 0.45, start, clock)},
+		{420, ""},
+		{350, fmt.Sprintf(PEAK_DOWNGRADE_TOOT_FORMAT, "South Australia", 0.45, 0.35, clock, 0.35, start, clock)},
+		{250, fmt.Sprintf(PEAK_CANCELLED_TOOT_FORMAT, "South Australia", 0.35, clock)},
+		// Having been cancelled, it has to get back over the enter threshold.
+		{450, ""},
+		{550, fmt.Sprintf(PEAK_TOOT_FORMAT, "South Australia", 0.55, clock, 0.55, start, clock)},
+	} {
+		gridBot.lastToot = ""
+		gridBot.forecasts = NewForecastRun("SA1", peakTime.Add(-FORECAST_INTERVAL_LENGTH), step.rrp)
+		gridBot.forecastsStale = false
+		gridBot.considerPostingToot()
+		if want, got := step.toot, gridBot.lastToot; want != got {
+			t.Errorf("At %.0f expected %q, got %q", step.rrp, want, got)
+		}
+	}
+}
+
+// An evening peak gets its own toots even though the afternoon one is higher.
+func TestGridBotPeakWindows(t *testing.T) {
+	gridBot, err := NewGridBot(GridBotCfg{RegionID: "NSW1", TestMode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := newFakeEventNotifier()
+	gridBot.notifiers = []Notifier{events}
+
+	start := time.Now().Add(30 * time.Minute).Truncate(FORECAST_INTERVAL_LENGTH)
+	at := func(n int) time.Time {
+		return start.Add(time.Duration(n) * FORECAST_INTERVAL_LENGTH)
+	}
+	window := func(t time.Time) *time.Time {
+		return &t
+	}
+	for _, step := range []struct {
+		rrps   []float64
+		events []PeakEvent
+	}{
+		{
+			[]float64{100, 900, 1500, 800, 100, 100, 700, 600, 100},
+			[]PeakEvent{
+				{Type: PeakEventPeak, RRP: 1500, PeakTime: at(3), AverageRRP: 3200.0 / 3, WindowStart: window(at(1)), WindowEnd: window(at(4))},
+				{Type: PeakEventPeak, RRP: 700, PeakTime: at(7), AverageRRP: 650, WindowStart: window(at(6)), WindowEnd: window(at(8))},
+			},
+		},
+		{
+			[]float64{100, 900, 1500, 800, 100, 100, 700, 1200, 100},
+			[]PeakEvent{
+				{Type: PeakEventPeak, RRP: 1200, PeakTime: at(8), AverageRRP: 950, WindowStart: window(at(6)), WindowEnd: window(at(8))},
+			},
+		},
+		{
+			[]float64{100, 900, 1500, 800, 100, 100, 100, 100, 100},
+			[]PeakEvent{
+				// The afternoon peak is still on, but the evening one's forecast is down to $100.
+				{Type: PeakEventCancelled, RRP: 100, PreviousRRP: 1200, PeakTime: at(8), WindowStart: window(at(6)), WindowEnd: window(at(8))},
+			},
+		},
+		{
+			[]float64{100, 900, 1500, 800, 100, 100, 700, 1200, 100},
+			[]PeakEvent{
+				{Type: PeakEventPeak, RRP: 1200, PeakTime: at(8), AverageRRP: 950, WindowStart: window(at(6)), WindowEnd: window(at(8))},
+			},
+		},
+		{
+			// Nothing's forecast for the evening any more.
+			[]float64{100, 900, 1500, 800, 100},
+			[]PeakEvent{
+				{Type: PeakEventCancelled, RRP: INTERESTING_PEAK_RRP, PreviousRRP: 1200, PeakTime: at(8), WindowStart: window(at(6)), WindowEnd: window(at(8))},
+			},
+		},
+	} {
+		gridBot.forecasts = NewForecastRun("NSW1", start, step.rrps...)
+		gridBot.forecastsStale = false
+		gridBot.peakRRP, gridBot.peakTime = 1500, at(3)
+		gridBot.considerPostingToot()
+		for _, want := range step.events {
+			got := events.waitForEvent(t)
+			if want.Type != got.Type || !FloatEquals(want.RRP, got.RRP) || !want.PeakTime.Equal(got.PeakTime) || !FloatEquals(want.AverageRRP, got.AverageRRP) {
+				t.Errorf("Expected %+v, got %+v", want, got)
+			}
+			if got.WindowStart == nil || !want.WindowStart.Equal(*got.WindowStart) || got.WindowEnd == nil || !want.WindowEnd.Equal(*got.WindowEnd) {
+				t.Errorf("Expected window %s to %s, got %v to %v", want.WindowStart, want.WindowEnd, got.WindowStart, got.WindowEnd)
+			}
+			if want.Type == PeakEventCancelled {
+				// A cancellation is about the peak we tooted, not whatever's forecast now.
+				if want, got := fmt.Sprintf(PEAK_CANCELLED_TOOT_FORMAT, "New South Wales", want.PreviousRRP/1000, gridBot.clock(want.PeakTime)), got.Message; want != got {
+					t.Errorf("Expected %s, got %s", want, got)
+				}
+				if want, got := want.PeakTime, gridBot.lastTootedPeakTime; !want.Equal(got) {
+					t.Errorf("Expected %s, got %s", want, got)
+				}
+			}
+		}
+		select {
+		case e := <-events.events:
+			t.Errorf("Expected no more events, got %+v", e)
+		default:
+		}
+	}
+}
+
+// The forecast only has what's left of a window once it's underway. That's no
+// reason to downgrade or cancel it.
+func TestGridBotPeakWindowUnderway(t *testing.T) {
+	gridBot, err := NewGridBot(GridBotCfg{RegionID: "NSW1", TestMode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := newFakeEventNotifier()
+	gridBot.notifiers = []Notifier{events}
+
+	start := time.Now().Add(30 * time.Minute).Truncate(FORECAST_INTERVAL_LENGTH)
+	at := func(n int) time.Time {
+		return start.Add(time.Duration(n) * FORECAST_INTERVAL_LENGTH)
+	}
+	gridBot.now = func() time.Time { return start }
+	gridBot.forecasts = NewForecastRun("NSW1", start, 100, 900, 1500, 800, 700, 100)
+	gridBot.forecastsStale = false
+	gridBot.considerPostingToot()
+	if want, got := PeakEventPeak, events.waitForEvent(t).Type; want != got {
+		t.Fatalf("Expected %s, got %s", want, got)
+	}
+
+	for _, step := range []struct {
+		now   time.Time
+		rrps  []float64 // Forecast from the half hour now is in.
+		event PeakEventType
+		rrp   float64 // Of the tooted window afterwards.
+		end   time.Time
+	}{
+		// Partway into the window, but before the peak.
+		{at(1).Add(10 * time.Minute), []float64{900, 1500, 800, 700, 100}, "", 1500, at(5)},
+		// The peak's been and gone, and what's left is lower.
+		{at(3).Add(10 * time.Minute), []float64{700, 600, 100}, "", 1500, at(5)},
+		// What's left drops below the exit threshold.
+		{at(3).Add(20 * time.Minute), []float64{100, 100, 100}, "", 1500, at(5)},
+		// What's left has a new, higher peak.
+		{at(3).Add(25 * time.Minute), []float64{700, 2000, 100}, PeakEventPeak, 2000, at(5)},
+	} {
+		gridBot.now = func() time.Time { return step.now }
+		gridBot.forecasts = NewForecastRun("NSW1", step.now.Truncate(FORECAST_INTERVAL_LENGTH), step.rrps...)
+		gridBot.forecastsStale = false
+		gridBot.considerPostingToot()
+		if step.event != "" {
+			if want, got := step.event, events.waitForEvent(t).Type; want != got {
+				t.Errorf("At %s expected %s, got %s", step.now, want, got)
+			}
+		}
+		select {
+		case e := <-events.events:
+			t.Errorf("At %s expected no more events, got %+v", step.now, e)
+		default:
+		}
+		if want, got := 1, len(gridBot.tootedPeaks); want != got {
+			t.Fatalf("At %s expected %d tooted windows, got %d", step.now, want, got)
+		}
+		// The part of the window that's passed stays as it was tooted.
+		w := gridBot.tootedPeaks[0]
+		if !w.Start.Equal(at(1)) || !w.End.Equal(step.end) || !FloatEquals(step.rrp, w.RRP) {
+			t.Errorf("At %s expected %s to %s peaking at %.0f, got %+v", step.now, at(1), step.end, step.rrp, w.PriceWindow)
+		}
+	}
+}
+
+func TestBuildGridBotsValidatesThresholds(t *testing.T) {
+	for _, tc := range []struct {
+		thresholds string
+		ok         bool
+	}{
+		{`"PeakEnterRRP": 300`, true},
+		{`"PeakEnterRRP": 300, "PeakExitRRP": 200, "PeakDeltaRRP": 20`, true},
+		{`"PeakEnterRRP": 300, "PeakExitRRP": 400`, false},
+		{`"PeakExitRRP": 600`, false},
+		{`"PeakEnterRRP": -1`, false},
+		{`"PeakDeltaRRP": -1`, false},
+		{`"DowngradeMode": "edit"`, true},
+		{`"DowngradeMode": "delete"`, false},
+		{`"PlotTheme": "dark"`, true},
+		{`"PlotTheme": "sepia"`, false},
+		{`"PeakEnterRRP": 300, "TroughRRP": 400`, true},
+		{`"PeakEnterRRP": 300, "TroughRRP": 400, "TroughsEnabled": true`, false},
+		{`"PeakEnterRRP": 300, "TroughRRP": 200, "TroughsEnabled": true`, true},
+	} {
+		cfg := config{TestMode: true}
+		cfg.GridBotCredentials = `[{"RegionID": "TAS1", ` + tc.thresholds + `}]`
+		if _, err := BuildGridBots(cfg); (err == nil) != tc.ok {
+			t.Errorf("Expected ok to be %t for %s, got %v", tc.ok, tc.thresholds, err)
+		}
+	}
+}
+
 func TestPlotting(t *testing.T) {
 	var err error
 	f, err := os.Open("data/exampledata.json")
@@ -436,3 +871,157 @@ func TestPostPlot(t *testing.T) {
 	time.Sleep(5 * time.Second)
 
 }
+
+// Updates to a peak are replies to the toot that announced it.
+func TestGridBotThreadsPeakUpdates(t *testing.T) {
+	gridBot, err := NewGridBot(GridBotCfg{RegionID: "QLD1", TestMode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	replies := newFakeReplyNotifier()
+	gridBot.notifiers = []Notifier{replies}
+
+	start := time.Now().Add(time.Hour).Truncate(FORECAST_INTERVAL_LENGTH)
+	for _, step := range []struct {
+		rrps      []float64
+		inReplyTo string
+	}{
+		{[]float64{100, 900, 100}, ""},
+		{[]float64{100, 1200, 100}, "1"},
+		{[]float64{100, 600, 100}, "1"},
+		{[]float64{100, 100, 100}, "1"},
+		// A new peak starts a new thread.
+		{[]float64{100, 800, 100}, ""},
+		{[]float64{100, 100, 100}, "5"},
+	} {
+		gridBot.forecasts = NewForecastRun("QLD1", start, step.rrps...)
+		gridBot.forecastsStale = false
+		gridBot.peakRRP = 100
+		gridBot.considerPostingToot()
+		replies.waitForPost(t)
+		if want, got := step.inReplyTo, <-replies.inReplyTo; want != got {
+			t.Errorf("For %v expected a reply to %q, got %q", step.rrps, want, got)
+		}
+	}
+}
+
+// In edit mode a downgrade revises the announcement where it can, and is posted
+// as usual everywhere else.
+func TestGridBotEditsDowngrades(t *testing.T) {
+	gridBot, err := NewGridBot(GridBotCfg{RegionID: "QLD1", TestMode: true, DowngradeMode: DOWNGRADE_MODE_EDIT})
+	if err != nil {
+		t.Fatal(err)
+	}
+	editor := newFakeEditNotifier()
+	events := newFakeEventNotifier()
+	gridBot.notifiers = []Notifier{editor, events}
+
+	start := time.Now().Add(time.Hour).Truncate(FORECAST_INTERVAL_LENGTH)
+	clock := func(n int) string {
+		return gridBot.clock(start.Add(time.Duration(n) * FORECAST_INTERVAL_LENGTH))
+	}
+	gridBot.forecasts = NewForecastRun("QLD1", start, 100, 900, 100)
+	gridBot.forecastsStale = false
+	gridBot.considerPostingToot()
+	editor.waitForPost(t)
+	<-editor.inReplyTo
+	events.waitForEvent(t)
+
+	gridBot.forecasts = NewForecastRun("QLD1", start, 100, 600, 100)
+	revisedAt := gridBot.clock(time.Now())
+	gridBot.considerPostingToot()
+	var e fakeEdit
+	select {
+	case e = <-editor.edits:
+	case p := <-editor.posts:
+		t.Fatalf("Expected an edit, got a post of %s", p.status)
+	}
+	if want, got := "1", e.id; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	revised := fmt.Sprintf(PEAK_TOOT_FORMAT, "Queensland", 0.6, clock(2), 0.6, clock(1), clock(2))
+	// The minute could tick over while it's tooting.
+	if e.status != revised+fmt.Sprintf(PEAK_REVISED_NOTE_FORMAT, revisedAt) && e.status != revised+fmt.Sprintf(PEAK_REVISED_NOTE_FORMAT, gridBot.clock(time.Now())) {
+		t.Errorf("Expected %s revised at %s, got %s", revised, revisedAt, e.status)
+	}
+	if want, got := PeakEventDowngrade, events.waitForEvent(t).Type; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if want, got := "1", gridBot.tootedPeaks[0].StatusIDs["fake"]; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	// Cancellations are still replies.
+	gridBot.forecasts = NewForecastRun("QLD1", start, 100, 100, 100)
+	gridBot.considerPostingToot()
+	editor.waitForPost(t)
+	if want, got := "1", <-editor.inReplyTo; want != got {
+		t.Errorf("Expected a reply to %s, got %s", want, got)
+	}
+}
+
+func TestGridBotDescribesPlots(t *testing.T) {
+	gridBot, err := NewGridBot(GridBotCfg{RegionID: "QLD1", TestMode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	notifier := newFakeNotifier()
+	gridBot.notifiers = []Notifier{notifier}
+
+	start := time.Now().Add(time.Hour).Truncate(FORECAST_INTERVAL_LENGTH)
+	gridBot.forecasts = NewForecastRun("QLD1", start, 100, 900, 100)
+	gridBot.forecastsStale = false
+	gridBot.considerPostingToot()
+	if want, got := DescribePrices("forecast wholesale electricity prices", gridBot.forecastPoints(), gridBot.location, UNITS_DOLLARS_PER_KWH), notifier.waitForPost(t).altText; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestGridBotPricePlot(t *testing.T) {
+	gridBot, err := NewGridBot(GridBotCfg{RegionID: "QLD1", TestMode: true, PeakEnterRRP: 400})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	// The first hour of these is too old to go on the plot.
+	for _, i := range NewActualRun("QLD1", now.Add(-PLOT_ACTUALS_HISTORY-time.Hour), make([]float64, 36)...) {
+		gridBot.processInterval(i)
+	}
+	gridBot.forecasts = NewForecastRun("QLD1", now.Truncate(FORECAST_INTERVAL_LENGTH), 100, 900, 100)
+
+	pp := gridBot.pricePlot(gridBot.forecasts, gridBot.actualsBetween(now.Add(-ACTUALS_RETENTION), now), gridBot.findPeakWindows(), now)
+	if want, got := 24, len(pp.Actual); want != got {
+		t.Errorf("Expected %d, got %d", want, got)
+	}
+	if want, got := 3, len(pp.Forecast); want != got {
+		t.Errorf("Expected %d, got %d", want, got)
+	}
+	if want, got := 400.0, pp.Threshold; !FloatEquals(want, got) {
+		t.Errorf("Expected %f, got %f", want, got)
+	}
+	if want, got := 1, len(pp.Peaks); want != got {
+		t.Fatalf("Expected %d, got %d", want, got)
+	}
+	if want, got := 900.0, pp.Peaks[0].RRP; !FloatEquals(want, got) {
+		t.Errorf("Expected %f, got %f", want, got)
+	}
+	if want, got := 0, len(pp.Demand); want != got {
+		t.Errorf("Expected %d, got %d", want, got)
+	}
+	if err := gridBot.generatePlot(new(bytes.Buffer)); err != nil {
+		t.Error(err)
+	}
+
+	gridBot.cfg.PlotDemand = true
+	gridBot.forecasts[1].TotalDemand = 7000
+	pp = gridBot.pricePlot(gridBot.forecasts, gridBot.actualsBetween(now.Add(-ACTUALS_RETENTION), now), gridBot.findPeakWindows(), now)
+	if want, got := 27, len(pp.Demand); want != got {
+		t.Fatalf("Expected %d, got %d", want, got)
+	}
+	if want, got := 7000.0, pp.Demand[25].Demand; !FloatEquals(want, got) {
+		t.Errorf("Expected %f, got %f", want, got)
+	}
+	if err := gridBot.generatePlot(new(bytes.Buffer)); err != nil {
+		t.Error(err)
+	}
+}
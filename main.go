@@ -3,20 +3,39 @@ package main
 import (
 	"fmt"
 	"log/slog"
+	"net/http"
 	"time"
 
 	"github.com/caarlos0/env/v9"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 type config struct {
-	MastodonURL          string `env:"MASTODON_SERVER" envDefault:"https://howse.social"`
-	MastodonClientID     string `env:"MASTODON_CLIENT_ID"`
-	MastodonClientSecret string `env:"MASTODON_CLIENT_SECRET"`
-	MastodonUserEmail    string `env:"MASTODON_USER_EMAIL"`
-	MastodonUserPassword string `env:"MASTODON_USER_PASSWORD"`
-	AEMOCheckInterval    int64  `env:"AEMO_CHECK_INTERVAL" envDefault:"1200"`
-	TestMode             bool   `env:"TEST_MODE" envDefault:"false"`
-	GridBotCredentials   string `env:"GRID_BOT_CREDENTIALS" envDefault:""`
+	MastodonURL          string   `env:"MASTODON_SERVER" envDefault:"https://howse.social"`
+	MastodonClientID     string   `env:"MASTODON_CLIENT_ID"`
+	MastodonClientSecret string   `env:"MASTODON_CLIENT_SECRET"`
+	MastodonUserEmail    string   `env:"MASTODON_USER_EMAIL"`
+	MastodonUserPassword string   `env:"MASTODON_USER_PASSWORD"`
+	AEMOCheckInterval    int64    `env:"AEMO_CHECK_INTERVAL" envDefault:"1200"`
+	TestMode             bool     `env:"TEST_MODE" envDefault:"false"`
+	GridBotCredentials   string   `env:"GRID_BOT_CREDENTIALS" envDefault:""`
+	StateStore           string   `env:"STATE_STORE" envDefault:""`
+	StatePath            string   `env:"STATE_PATH" envDefault:""`
+	TootTemplatesPath    string   `env:"TOOT_TEMPLATES_PATH" envDefault:""`
+	MQTTBroker           string   `env:"MQTT_BROKER" envDefault:""`
+	MQTTClientID         string   `env:"MQTT_CLIENT_ID" envDefault:"ausgridbot"`
+	MQTTUsername         string   `env:"MQTT_USERNAME"`
+	MQTTPassword         string   `env:"MQTT_PASSWORD"`
+	MQTTTopicPrefix      string   `env:"MQTT_TOPIC_PREFIX" envDefault:"ausgridbot"`
+	MQTTDiscoveryPrefix  string   `env:"MQTT_DISCOVERY_PREFIX" envDefault:"homeassistant"`
+	SMTPHost             string   `env:"SMTP_HOST" envDefault:""`
+	SMTPPort             int      `env:"SMTP_PORT" envDefault:"587"`
+	SMTPUsername         string   `env:"SMTP_USERNAME"`
+	SMTPPassword         string   `env:"SMTP_PASSWORD"`
+	SMTPFrom             string   `env:"SMTP_FROM"`
+	SMTPTo               []string `env:"SMTP_TO" envSeparator:","`
+	SMTPDigest           bool     `env:"SMTP_DIGEST" envDefault:"false"`
+	HTTPListenAddr       string   `env:"HTTP_LISTEN_ADDR" envDefault:""`
 }
 
 type gridBotMap map[RegionID]*GridBot
@@ -32,10 +51,39 @@ func main() {
 
 	var gridBots gridBotMap
 	if gridBots, err = BuildGridBots(cfg); err != nil {
-		slog.Error("Failed to build GridBots:", err)
+		slog.Error("Failed to build GridBots", "err", err)
 		return
 	}
 
+	var mqtt *MQTT
+	if cfg.MQTTBroker != "" {
+		mqtt = NewMQTT(cfg.MQTTBroker, cfg.MQTTClientID, cfg.MQTTUsername, cfg.MQTTPassword, cfg.MQTTTopicPrefix, cfg.MQTTDiscoveryPrefix)
+		for _, gb := range gridBots {
+			gb.AddNotifier(mqtt)
+		}
+	}
+
+	if cfg.SMTPHost != "" {
+		email := NewEmail(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom, cfg.SMTPTo, cfg.SMTPDigest)
+		for _, gb := range gridBots {
+			gb.AddNotifier(email)
+		}
+	}
+
+	var api *API
+	if cfg.HTTPListenAddr != "" {
+		api = NewAPI(gridBots)
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		mux.Handle("/", api)
+		go func() {
+			slog.Info("Serving API", "addr", cfg.HTTPListenAddr)
+			if err := http.ListenAndServe(cfg.HTTPListenAddr, mux); err != nil {
+				slog.Error("API server stopped", "err", err)
+			}
+		}()
+	}
+
 	// Start the main loop for each GridBot
 	for _, gb := range gridBots {
 		go gb.Mainloop()
@@ -51,10 +99,24 @@ func main() {
 			slog.Info("Got data")
 		}
 
+		regionIntervals := make(map[RegionID][]Interval)
 		for _, i := range aemoData.Intervals {
 			// Send the interval to the appropriate GridBot
 			if gb, ok := gridBots[i.RegionID]; ok {
 				gb.GetIntervalChannel() <- i
+				regionIntervals[i.RegionID] = append(regionIntervals[i.RegionID], i)
+			}
+		}
+
+		if api != nil && err == nil {
+			api.SetIntervals(aemoData.Intervals)
+		}
+
+		if mqtt != nil {
+			for regionID, intervals := range regionIntervals {
+				if err := mqtt.PublishIntervals(regionID, intervals); err != nil {
+					slog.Error("failed to publish to MQTT", "region", regionID, "err", err)
+				}
 			}
 		}
 
@@ -2,35 +2,71 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
 
 	"github.com/mattn/go-mastodon"
 )
 
 type Mastodon struct {
-	c *mastodon.Client
+	c            *mastodon.Client
+	cfg          *mastodon.Config
+	userEmail    string
+	userPassword string
 }
 
-func NewMastodon(server, id, secret, userEmail, userPassword string) (*Mastodon, error) {
-	m := &Mastodon{}
-	m.c = mastodon.NewClient(&mastodon.Config{
-		Server:       server,
-		ClientID:     id,
-		ClientSecret: secret,
-	})
-	err := m.c.Authenticate(context.Background(), userEmail, userPassword)
+// NewMastodon doesn't connect to the server straight away, it logs in the
+// first time it's used and again after any failed request.
+func NewMastodon(server, id, secret, userEmail, userPassword string) *Mastodon {
+	return &Mastodon{
+		cfg: &mastodon.Config{
+			Server:       server,
+			ClientID:     id,
+			ClientSecret: secret,
+		},
+		userEmail:    userEmail,
+		userPassword: userPassword,
+	}
+}
+
+func (m *Mastodon) Name() string {
+	return "mastodon"
+}
+
+// Logs in to the server if we aren't already.
+func (m *Mastodon) connect() error {
+	if m.c != nil {
+		return nil
+	}
+	c := mastodon.NewClient(m.cfg)
+	if err := c.Authenticate(context.Background(), m.userEmail, m.userPassword); err != nil {
+		return fmt.Errorf("failed to connect to mastodon: %s", err)
+	}
+	m.c = c
+	return nil
+}
+
+// Drops the connection if err is set, so the next request logs in again.
+func (m *Mastodon) checkErr(err error) error {
 	if err != nil {
-		return nil, err
+		m.c = nil
 	}
-	return m, nil
+	return err
 }
 
 // Posts a status update
 func (m *Mastodon) PostStatus(status string) error {
+	if err := m.connect(); err != nil {
+		return err
+	}
 	_, err := m.c.PostStatus(context.Background(), &mastodon.Toot{
 		Status: status,
 	})
-	return err
+	return m.checkErr(err)
 }
 
 func (m *Mastodon) GetRecentDMs() ([]string, error) {
@@ -53,38 +89,94 @@ func (m *Mastodon) GetRecentDMs() ([]string, error) {
 
 // Gets my last `n` statuses
 func (m *Mastodon) GetMyStatuses(n int64) ([]*mastodon.Status, error) {
-	if account, err := m.c.GetAccountCurrentUser(context.Background()); err != nil {
+	if err := m.connect(); err != nil {
 		return nil, err
+	}
+	if account, err := m.c.GetAccountCurrentUser(context.Background()); err != nil {
+		return nil, m.checkErr(err)
 	} else {
-		return m.c.GetAccountStatuses(context.Background(), account.ID, &mastodon.Pagination{
+		statuses, err := m.c.GetAccountStatuses(context.Background(), account.ID, &mastodon.Pagination{
 			Limit: n,
 		})
+		return statuses, m.checkErr(err)
 	}
 }
 
 // Posts a status with an image attached
 func (m *Mastodon) PostStatusWithImage(status string, filename string) error {
+	if err := m.connect(); err != nil {
+		return err
+	}
 	a, err := m.c.UploadMedia(context.Background(), filename)
 	if err != nil {
-		return err
+		return m.checkErr(err)
 	}
 	_, err = m.c.PostStatus(context.Background(), &mastodon.Toot{
 		Status:   status,
 		MediaIDs: []mastodon.ID{a.ID},
 	})
-	return err
+	return m.checkErr(err)
 }
 
-// Posts a status with an image attached
-func (m *Mastodon) PostStatusWithImageFromReader(status string, file io.Reader, visibility string) error {
-	a, err := m.c.UploadMediaFromReader(context.Background(), file)
+// Posts a status with an image attached, and returns its ID
+func (m *Mastodon) PostStatusWithImageFromReader(status string, file io.Reader, altText string, visibility string) (string, error) {
+	return m.PostReplyWithImageFromReader(status, file, altText, visibility, "")
+}
+
+// Posts a status with an image attached as a reply to inReplyToID, or on its own
+// if that's empty, and returns the new status's ID.
+func (m *Mastodon) PostReplyWithImageFromReader(status string, file io.Reader, altText string, visibility string, inReplyToID string) (string, error) {
+	if err := m.connect(); err != nil {
+		return "", err
+	}
+	a, err := m.c.UploadMediaFromMedia(context.Background(), &mastodon.Media{File: file, Description: altText})
 	if err != nil {
-		return err
+		return "", m.checkErr(err)
 	}
-	_, err = m.c.PostStatus(context.Background(), &mastodon.Toot{
-		Status:     status,
-		MediaIDs:   []mastodon.ID{a.ID},
-		Visibility: visibility,
+	s, err := m.c.PostStatus(context.Background(), &mastodon.Toot{
+		Status:      status,
+		MediaIDs:    []mastodon.ID{a.ID},
+		Visibility:  visibility,
+		InReplyToID: mastodon.ID(inReplyToID),
 	})
-	return err
+	if err != nil {
+		return "", m.checkErr(err)
+	}
+	return string(s.ID), nil
+}
+
+// Replaces the text and image of one of our statuses. go-mastodon can't edit
+// statuses, so this calls the API itself.
+func (m *Mastodon) EditStatusWithImageFromReader(id string, status string, file io.Reader, altText string) error {
+	if err := m.connect(); err != nil {
+		return err
+	}
+	a, err := m.c.UploadMediaFromMedia(context.Background(), &mastodon.Media{File: file, Description: altText})
+	if err != nil {
+		return m.checkErr(err)
+	}
+	u, err := url.Parse(m.cfg.Server)
+	if err != nil {
+		return err
+	}
+	u.Path = path.Join(u.Path, "/api/v1/statuses", id)
+	form := url.Values{
+		"status":      {status},
+		"media_ids[]": {string(a.ID)},
+	}
+	req, err := http.NewRequest(http.MethodPut, u.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+m.cfg.AccessToken)
+	resp, err := m.c.Do(req)
+	if err != nil {
+		return m.checkErr(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return m.checkErr(fmt.Errorf("failed to edit status %s: %s", id, resp.Status))
+	}
+	return nil
 }
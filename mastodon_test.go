@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newFakeMastodonServer stands in for a Mastodon server, recording the form of
+// each status posted to it. Media IDs are the media's description.
+func newFakeMastodonServer(t *testing.T) (*httptest.Server, chan map[string]string) {
+	statuses := make(chan map[string]string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/oauth/token":
+			json.NewEncoder(w).Encode(map[string]string{"access_token": "token"})
+		case "/api/v1/media":
+			// Name the media after its description, so it shows up with the status.
+			json.NewEncoder(w).Encode(map[string]string{"id": r.FormValue("description")})
+		case "/api/v1/statuses/42":
+			if want, got := http.MethodPut, r.Method; want != got {
+				t.Errorf("Expected %s, got %s", want, got)
+			}
+			fallthrough
+		case "/api/v1/statuses":
+			if err := r.ParseForm(); err != nil {
+				t.Error(err)
+			}
+			statuses <- map[string]string{
+				"path":           r.URL.Path,
+				"status":         r.FormValue("status"),
+				"in_reply_to_id": r.FormValue("in_reply_to_id"),
+				"media_ids":      r.FormValue("media_ids[]"),
+			}
+			json.NewEncoder(w).Encode(map[string]string{"id": "42"})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, statuses
+}
+
+func TestMastodonPostReply(t *testing.T) {
+	server, statuses := newFakeMastodonServer(t)
+	m := NewMastodon(server.URL, "id", "secret", "email", "password")
+
+	id, err := m.PostReplyWithImageFromReader("Hello", strings.NewReader("image"), "A plot", "public", "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "42", id; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	s := <-statuses
+	if want, got := "7", s["in_reply_to_id"]; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if want, got := "A plot", s["media_ids"]; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	// Without a status to reply to it's a status of its own.
+	if _, err := m.PostStatusWithImageFromReader("Hello", strings.NewReader("image"), "A plot", "public"); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := "", (<-statuses)["in_reply_to_id"]; want != got {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestMastodonEditStatus(t *testing.T) {
+	server, statuses := newFakeMastodonServer(t)
+	m := NewMastodon(server.URL, "id", "secret", "email", "password")
+
+	if err := m.EditStatusWithImageFromReader("42", "Revised", strings.NewReader("image"), "A revised plot"); err != nil {
+		t.Fatal(err)
+	}
+	s := <-statuses
+	if want, got := "/api/v1/statuses/42", s["path"]; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if want, got := "Revised", s["status"]; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if want, got := "A revised plot", s["media_ids"]; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	if err := m.EditStatusWithImageFromReader("43", "Revised", strings.NewReader("image"), "A revised plot"); err == nil {
+		t.Error("Expected an error editing a status that doesn't exist")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/png"
+	"io"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+const MATRIX_PLOT_FILENAME = "forecast.png"
+
+// Matrix posts to a Matrix room using the client-server API.
+type Matrix struct {
+	homeserverURL string
+	accessToken   string
+	roomID        string
+	client        *http.Client
+	txnCounter    atomic.Int64
+}
+
+func NewMatrix(homeserverURL, accessToken, roomID string) *Matrix {
+	return &Matrix{
+		homeserverURL: homeserverURL,
+		accessToken:   accessToken,
+		roomID:        roomID,
+		client:        &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (m *Matrix) Name() string {
+	return "matrix"
+}
+
+type matrixError struct {
+	ErrCode string `json:"errcode"`
+	Error   string `json:"error"`
+}
+
+func (m *Matrix) do(method, path, contentType string, body io.Reader, out any) error {
+	req, err := http.NewRequest(method, m.homeserverURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.accessToken)
+	req.Header.Set("Content-Type", contentType)
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var e matrixError
+		json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("%s got status code %d: %s %s", path, resp.StatusCode, e.ErrCode, e.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Sends an m.room.message event to the room.
+func (m *Matrix) sendMessage(content any) error {
+	b, err := json.Marshal(content)
+	if err != nil {
+		return err
+	}
+	// The transaction ID only has to be unique for this access token, it's what
+	// stops the server duplicating the event if we retry.
+	txnID := fmt.Sprintf("gridbot-%d-%d", time.Now().UnixNano(), m.txnCounter.Add(1))
+	path := fmt.Sprintf("/_matrix/client/v3/rooms/%s/send/m.room.message/%s", url.PathEscape(m.roomID), txnID)
+	return m.do("PUT", path, "application/json", bytes.NewReader(b), nil)
+}
+
+func (m *Matrix) PostStatus(status string) error {
+	return m.sendMessage(map[string]string{
+		"msgtype": "m.text",
+		"body":    status,
+	})
+}
+
+// Posts the status as a text message followed by the image.
+func (m *Matrix) PostStatusWithImageFromReader(status string, file io.Reader, altText string, visibility string) (string, error) {
+	b, err := io.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
+	var upload struct {
+		ContentURI string `json:"content_uri"`
+	}
+	path := "/_matrix/media/v3/upload?filename=" + url.QueryEscape(MATRIX_PLOT_FILENAME)
+	if err := m.do("POST", path, "image/png", bytes.NewReader(b), &upload); err != nil {
+		return "", err
+	}
+
+	if err := m.PostStatus(status); err != nil {
+		return "", err
+	}
+
+	info := map[string]any{
+		"mimetype": "image/png",
+		"size":     len(b),
+	}
+	if c, _, err := image.DecodeConfig(bytes.NewReader(b)); err == nil {
+		info["w"] = c.Width
+		info["h"] = c.Height
+	}
+	// An image's body is its text alternative.
+	body := altText
+	if body == "" {
+		body = MATRIX_PLOT_FILENAME
+	}
+	return "", m.sendMessage(map[string]any{
+		"msgtype": "m.image",
+		"body":    body,
+		"url":     upload.ContentURI,
+		"info":    info,
+	})
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMatrixPostStatusWithImage(t *testing.T) {
+	var uploaded []byte
+	var events []map[string]any
+	txnIDs := make(map[string]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if want, got := "Bearer token", r.Header.Get("Authorization"); want != got {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/_matrix/media/v3/upload":
+			if want, got := "image/png", r.Header.Get("Content-Type"); want != got {
+				t.Errorf("Expected %s, got %s", want, got)
+			}
+			uploaded, _ = io.ReadAll(r.Body)
+			w.Write([]byte(`{"content_uri":"mxc://example.org/plot"}`))
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/_matrix/client/v3/rooms/!room:example.org/send/m.room.message/"):
+			txnID := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+			if txnIDs[txnID] {
+				t.Errorf("Reused transaction ID %s", txnID)
+			}
+			txnIDs[txnID] = true
+			var e map[string]any
+			if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+				t.Error(err)
+			}
+			events = append(events, e)
+			w.Write([]byte(`{"event_id":"$event"}`))
+		default:
+			t.Errorf("Unexpected %s to %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	var plot bytes.Buffer
+	if err := GetPlot(nil, nil, &plot); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMatrix(server.URL, "token", "!room:example.org")
+	if _, err := m.PostStatusWithImageFromReader("A peak!", bytes.NewReader(plot.Bytes()), "A plot", "public"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(plot.Bytes(), uploaded) {
+		t.Errorf("Uploaded image doesn't match the plot")
+	}
+	if want, got := 2, len(events); want != got {
+		t.Fatalf("Expected %d events, got %d", want, got)
+	}
+	if want, got := "m.text", events[0]["msgtype"]; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if want, got := "A peak!", events[0]["body"]; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if want, got := "m.image", events[1]["msgtype"]; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if want, got := "A plot", events[1]["body"]; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if want, got := "mxc://example.org/plot", events[1]["url"]; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	info := events[1]["info"].(map[string]any)
+	if want, got := float64(len(plot.Bytes())), info["size"]; want != got {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if _, ok := info["w"]; !ok {
+		t.Errorf("Expected the image width to be set")
+	}
+}
+
+func TestMatrixError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"errcode":"M_FORBIDDEN","error":"You are not in this room."}`))
+	}))
+	defer server.Close()
+
+	m := NewMatrix(server.URL, "token", "!room:example.org")
+	err := m.PostStatus("A peak!")
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	if !strings.Contains(err.Error(), "M_FORBIDDEN") {
+		t.Errorf("Expected the Matrix error code in %s", err)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// These are served at /metrics alongside the HTTP API. Prices are in $/MWh, as
+// they come from AEMO.
+var (
+	actualRRPGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ausgridbot_actual_rrp",
+		Help: "The latest actual regional reference price, in $/MWh.",
+	}, []string{"region"})
+	totalDemandGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ausgridbot_total_demand_megawatts",
+		Help: "The latest actual total demand.",
+	}, []string{"region"})
+	forecastPeakRRPGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ausgridbot_forecast_peak_rrp",
+		Help: "The highest forecast regional reference price in the next 8 hours, in $/MWh.",
+	}, []string{"region"})
+	forecastPeakTimeGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ausgridbot_forecast_peak_time_seconds",
+		Help: "When the forecast peak is, as a unix timestamp.",
+	}, []string{"region"})
+
+	aemoFetchDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "ausgridbot_aemo_fetch_duration_seconds",
+		Help:    "How long it takes to get data from AEMO, whether it works or not.",
+		Buckets: prometheus.ExponentialBuckets(0.25, 2, 8),
+	})
+	aemoFetchErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ausgridbot_aemo_fetch_errors_total",
+		Help: "Failed attempts to get data from AEMO, by what went wrong.",
+	}, []string{"cause"})
+	intervalValidationFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "ausgridbot_interval_validation_failures_total",
+		Help: "Intervals from AEMO that failed validation.",
+	})
+
+	tootsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ausgridbot_toots_sent_total",
+		Help: "Toots posted, by region and notifier.",
+	}, []string{"region", "notifier"})
+	tootsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ausgridbot_toots_failed_total",
+		Help: "Toots that failed to post, by region and notifier.",
+	}, []string{"region", "notifier"})
+)
+
+// The reasons GetAEMOData can fail, for aemoFetchErrors.
+const (
+	AEMO_FETCH_ERROR_REQUEST    = "request"
+	AEMO_FETCH_ERROR_STATUS     = "status"
+	AEMO_FETCH_ERROR_READ       = "read"
+	AEMO_FETCH_ERROR_DECODE     = "decode"
+	AEMO_FETCH_ERROR_VALIDATION = "validation"
+)
+
+// Sets the region's gauges from the batch of intervals Mainloop just finished.
+func (gb *GridBot) updateMetrics() {
+	region := string(gb.cfg.RegionID)
+	if !gb.latestActual.SettlementDate.IsZero() {
+		actualRRPGauge.WithLabelValues(region).Set(gb.latestActual.RRP)
+		totalDemandGauge.WithLabelValues(region).Set(gb.latestActual.TotalDemand)
+	}
+	if !gb.forecastsStale {
+		forecastPeakRRPGauge.WithLabelValues(region).Set(gb.peakRRP)
+		forecastPeakTimeGauge.WithLabelValues(region).Set(float64(gb.peakTime.Unix()))
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestAEMOFetchMetrics(t *testing.T) {
+	var status int
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+	aemo := NewAEMO()
+
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		cause  string
+	}{
+		{"bad status", http.StatusBadGateway, "", AEMO_FETCH_ERROR_STATUS},
+		{"bad json", http.StatusOK, "{", AEMO_FETCH_ERROR_DECODE},
+		{"bad interval", http.StatusOK, `{"5MIN":[{"REGIONID":"WA1","REGION":"WA1","PERIODTYPE":"ACTUAL"}]}`, AEMO_FETCH_ERROR_VALIDATION},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			status, body = tc.status, tc.body
+			errorsBefore := testutil.ToFloat64(aemoFetchErrors.WithLabelValues(tc.cause))
+			validationBefore := testutil.ToFloat64(intervalValidationFailures)
+
+			if _, err := aemo.GetAEMOData(server.URL); err == nil {
+				t.Fatal("Expected an error")
+			}
+
+			if want, got := errorsBefore+1, testutil.ToFloat64(aemoFetchErrors.WithLabelValues(tc.cause)); !FloatEquals(want, got) {
+				t.Errorf("Expected %f, got %f", want, got)
+			}
+			wantValidation := validationBefore
+			if tc.cause == AEMO_FETCH_ERROR_VALIDATION {
+				wantValidation++
+			}
+			if want, got := wantValidation, testutil.ToFloat64(intervalValidationFailures); !FloatEquals(want, got) {
+				t.Errorf("Expected %f, got %f", want, got)
+			}
+		})
+	}
+
+	if testutil.CollectAndCount(aemoFetchDuration) != 1 {
+		t.Errorf("Expected the fetch duration histogram to be collected")
+	}
+}
+
+func TestGridBotMetrics(t *testing.T) {
+	gridBot, err := NewGridBot(GridBotCfg{RegionID: "SA1", TestMode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fails := newFakeNotifier()
+	fails.err = errors.New("nope")
+	gridBot.notifiers = []Notifier{newFakeNotifier(), fails}
+
+	now := time.Now().Truncate(time.Minute)
+	actual := Interval{SettlementDate: JSONTime{now}, RegionID: "SA1", Region: "SA1", PeriodType: "ACTUAL", RRP: 120, TotalDemand: 1500}
+	older := actual
+	older.SettlementDate = JSONTime{now.Add(-5 * time.Minute)}
+	older.RRP = 80
+	gridBot.processInterval(actual)
+	gridBot.processInterval(older)
+	peak := Interval{SettlementDate: JSONTime{now.Add(1 * time.Hour)}, RegionID: "SA1", Region: "SA1", PeriodType: "FORECAST", RRP: 900}
+	gridBot.processInterval(peak)
+
+	gridBot.considerPostingToot()
+	gridBot.updateMetrics()
+
+	if want, got := 120.0, testutil.ToFloat64(actualRRPGauge.WithLabelValues("SA1")); !FloatEquals(want, got) {
+		t.Errorf("Expected %f, got %f", want, got)
+	}
+	if want, got := 1500.0, testutil.ToFloat64(totalDemandGauge.WithLabelValues("SA1")); !FloatEquals(want, got) {
+		t.Errorf("Expected %f, got %f", want, got)
+	}
+	if want, got := 900.0, testutil.ToFloat64(forecastPeakRRPGauge.WithLabelValues("SA1")); !FloatEquals(want, got) {
+		t.Errorf("Expected %f, got %f", want, got)
+	}
+	if want, got := float64(peak.SettlementDate.Unix()), testutil.ToFloat64(forecastPeakTimeGauge.WithLabelValues("SA1")); !FloatEquals(want, got) {
+		t.Errorf("Expected %f, got %f", want, got)
+	}
+	if want, got := 1.0, testutil.ToFloat64(tootsSent.WithLabelValues("SA1", "fake")); !FloatEquals(want, got) {
+		t.Errorf("Expected %f, got %f", want, got)
+	}
+	if want, got := 1.0, testutil.ToFloat64(tootsFailed.WithLabelValues("SA1", "fake")); !FloatEquals(want, got) {
+		t.Errorf("Expected %f, got %f", want, got)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// mqttPublisher is the part of the paho client we use, so tests can swap it out.
+type mqttPublisher interface {
+	Publish(topic string, qos byte, retained bool, payload interface{}) paho.Token
+}
+
+// MQTT publishes the latest prices for each region, and any peak events, to an
+// MQTT broker. It also publishes Home Assistant discovery config so the prices
+// show up as sensors. One is shared by every GridBot.
+type MQTT struct {
+	client          mqttPublisher
+	topicPrefix     string
+	discoveryPrefix string // Blank to not publish Home Assistant discovery config.
+
+	mu            sync.Mutex
+	discoverySent map[RegionID]bool
+}
+
+func NewMQTT(broker, clientID, username, password, topicPrefix, discoveryPrefix string) *MQTT {
+	opts := paho.NewClientOptions().
+		AddBroker(broker).
+		SetClientID(clientID).
+		SetUsername(username).
+		SetPassword(password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true)
+	client := paho.NewClient(opts)
+	// With SetConnectRetry this keeps trying in the background rather than failing.
+	client.Connect()
+	return newMQTT(client, topicPrefix, discoveryPrefix)
+}
+
+func newMQTT(client mqttPublisher, topicPrefix, discoveryPrefix string) *MQTT {
+	return &MQTT{
+		client:          client,
+		topicPrefix:     topicPrefix,
+		discoveryPrefix: discoveryPrefix,
+		discoverySent:   make(map[RegionID]bool),
+	}
+}
+
+func (m *MQTT) Name() string {
+	return "mqtt"
+}
+
+func (m *MQTT) topic(regionID RegionID, name string) string {
+	return fmt.Sprintf("%s/%s/%s", m.topicPrefix, regionID, name)
+}
+
+// Queues a message with the client without waiting for the broker, so a slow
+// or missing broker doesn't hold up the main loop. Failures are logged once
+// the client gives up on the message.
+func (m *MQTT) publish(topic string, retained bool, payload any) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	t := m.client.Publish(topic, 1, retained, b)
+	go func() {
+		<-t.Done()
+		if err := t.Error(); err != nil {
+			slog.Error("Failed to publish to MQTT", "topic", topic, "error", err)
+		}
+	}()
+	return nil
+}
+
+type mqttForecast struct {
+	PeakRRP   float64        `json:"peak_rrp"`
+	PeakTime  time.Time      `json:"peak_time"`
+	Intervals []IntervalJSON `json:"intervals"`
+}
+
+// Publishes a region's intervals as retained messages. The latest actual goes
+// to <prefix>/<region>/actual and the whole forecast to <prefix>/<region>/forecast.
+func (m *MQTT) PublishIntervals(regionID RegionID, intervals []Interval) error {
+	if err := m.publishDiscovery(regionID); err != nil {
+		return err
+	}
+
+	var actual *Interval
+	forecast := mqttForecast{Intervals: []IntervalJSON{}}
+	for n, i := range intervals {
+		switch i.PeriodType {
+		case "ACTUAL":
+			if actual == nil || i.SettlementDate.After(actual.SettlementDate.Time) {
+				actual = &intervals[n]
+			}
+		case "FORECAST":
+			if len(forecast.Intervals) == 0 || i.RRP > forecast.PeakRRP {
+				forecast.PeakRRP = i.RRP
+				forecast.PeakTime = i.SettlementDate.Time
+			}
+			forecast.Intervals = append(forecast.Intervals, NewIntervalJSON(i))
+		}
+	}
+
+	if actual != nil {
+		if err := m.publish(m.topic(regionID, "actual"), true, NewIntervalJSON(*actual)); err != nil {
+			return err
+		}
+	}
+	if len(forecast.Intervals) > 0 {
+		if err := m.publish(m.topic(regionID, "forecast"), true, forecast); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type mqttSensor struct {
+	key           string
+	name          string
+	topic         string
+	valueTemplate string
+	unit          string
+	deviceClass   string
+}
+
+// Publishes Home Assistant MQTT discovery config for a region's sensors, once.
+func (m *MQTT) publishDiscovery(regionID RegionID) error {
+	if m.discoveryPrefix == "" {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.discoverySent[regionID] {
+		return nil
+	}
+
+	regionString, err := RegionIDToRegionString(regionID)
+	if err != nil {
+		return err
+	}
+	sensors := []mqttSensor{
+		{"rrp", "Price", "actual", "{{ value_json.rrp }}", "$/MWh", ""},
+		{"total_demand", "Total demand", "actual", "{{ value_json.total_demand }}", "MW", "power"},
+		{"net_interchange", "Net interchange", "actual", "{{ value_json.net_interchange }}", "MW", "power"},
+		{"scheduled_generation", "Scheduled generation", "actual", "{{ value_json.scheduled_generation }}", "MW", "power"},
+		{"semischeduled_generation", "Semi-scheduled generation", "actual", "{{ value_json.semischeduled_generation }}", "MW", "power"},
+		{"forecast_peak_rrp", "Forecast peak price", "forecast", "{{ value_json.peak_rrp }}", "$/MWh", ""},
+		{"forecast_peak_time", "Forecast peak time", "forecast", "{{ value_json.peak_time }}", "", "timestamp"},
+	}
+	device := map[string]any{
+		"identifiers":  []string{"ausgridbot_" + strings.ToLower(string(regionID))},
+		"name":         "AusGridBot " + regionString,
+		"manufacturer": "AEMO",
+		"model":        "National Electricity Market region " + string(regionID),
+	}
+	for _, s := range sensors {
+		uniqueID := fmt.Sprintf("ausgridbot_%s_%s", strings.ToLower(string(regionID)), s.key)
+		config := map[string]any{
+			"name":           s.name,
+			"unique_id":      uniqueID,
+			"object_id":      uniqueID,
+			"state_topic":    m.topic(regionID, s.topic),
+			"value_template": s.valueTemplate,
+			"device":         device,
+		}
+		if s.unit != "" {
+			config["unit_of_measurement"] = s.unit
+			config["state_class"] = "measurement"
+		}
+		if s.deviceClass != "" {
+			config["device_class"] = s.deviceClass
+		}
+		topic := fmt.Sprintf("%s/sensor/%s/config", m.discoveryPrefix, uniqueID)
+		if err := m.publish(topic, true, config); err != nil {
+			return err
+		}
+	}
+	m.discoverySent[regionID] = true
+	return nil
+}
+
+// Publishes the peak event to <prefix>/<region>/peak.
+func (m *MQTT) NotifyEvent(e PeakEvent, image []byte) error {
+	return m.publish(m.topic(e.RegionID, "peak"), false, e)
+}
+
+// Plain toots aren't about any particular region, so there's nowhere sensible
+// to publish them.
+func (m *MQTT) PostStatus(status string) error {
+	slog.Debug("Not publishing toot to MQTT", "toot", status)
+	return nil
+}
+
+func (m *MQTT) PostStatusWithImageFromReader(status string, file io.Reader, altText string, visibility string) (string, error) {
+	return "", m.PostStatus(status)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+type fakeToken struct{}
+
+func (fakeToken) Wait() bool                     { return true }
+func (fakeToken) WaitTimeout(time.Duration) bool { return true }
+func (fakeToken) Done() <-chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}
+func (fakeToken) Error() error { return nil }
+
+type fakeMessage struct {
+	payload  []byte
+	retained bool
+}
+
+// fakeBroker remembers the last message published to each topic.
+type fakeBroker struct {
+	messages map[string]fakeMessage
+}
+
+func (b *fakeBroker) Publish(topic string, qos byte, retained bool, payload interface{}) paho.Token {
+	b.messages[topic] = fakeMessage{payload: payload.([]byte), retained: retained}
+	return fakeToken{}
+}
+
+func (b *fakeBroker) decode(topic string, v any, t *testing.T) fakeMessage {
+	m, ok := b.messages[topic]
+	if !ok {
+		t.Fatalf("Nothing published to %s", topic)
+	}
+	if err := json.Unmarshal(m.payload, v); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestMQTTPublishIntervals(t *testing.T) {
+	broker := &fakeBroker{messages: make(map[string]fakeMessage)}
+	m := newMQTT(broker, "ausgridbot", "homeassistant")
+
+	now := time.Date(2024, 1, 30, 16, 30, 0, 0, time.UTC)
+	intervals := []Interval{
+		{SettlementDate: JSONTime{now.Add(-30 * time.Minute)}, RegionID: "QLD1", PeriodType: "ACTUAL", RRP: 80},
+		{SettlementDate: JSONTime{now}, RegionID: "QLD1", PeriodType: "ACTUAL", RRP: 90, TotalDemand: 7000},
+		{SettlementDate: JSONTime{now.Add(30 * time.Minute)}, RegionID: "QLD1", PeriodType: "FORECAST", RRP: 300},
+		{SettlementDate: JSONTime{now.Add(60 * time.Minute)}, RegionID: "QLD1", PeriodType: "FORECAST", RRP: 600},
+		{SettlementDate: JSONTime{now.Add(90 * time.Minute)}, RegionID: "QLD1", PeriodType: "FORECAST", RRP: 200},
+	}
+	if err := m.PublishIntervals("QLD1", intervals); err != nil {
+		t.Fatal(err)
+	}
+
+	var actual IntervalJSON
+	if msg := broker.decode("ausgridbot/QLD1/actual", &actual, t); !msg.retained {
+		t.Errorf("Expected actual to be retained")
+	}
+	if want, got := 90.0, actual.RRP; !FloatEquals(want, got) {
+		t.Errorf("Expected %f, got %f", want, got)
+	}
+	if want, got := 7000.0, actual.TotalDemand; !FloatEquals(want, got) {
+		t.Errorf("Expected %f, got %f", want, got)
+	}
+
+	var forecast mqttForecast
+	if msg := broker.decode("ausgridbot/QLD1/forecast", &forecast, t); !msg.retained {
+		t.Errorf("Expected forecast to be retained")
+	}
+	if want, got := 3, len(forecast.Intervals); want != got {
+		t.Fatalf("Expected %d, got %d", want, got)
+	}
+	if want, got := 600.0, forecast.PeakRRP; !FloatEquals(want, got) {
+		t.Errorf("Expected %f, got %f", want, got)
+	}
+	if want, got := now.Add(60*time.Minute), forecast.PeakTime; !want.Equal(got) {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	var config map[string]any
+	if msg := broker.decode("homeassistant/sensor/ausgridbot_qld1_rrp/config", &config, t); !msg.retained {
+		t.Errorf("Expected discovery config to be retained")
+	}
+	if want, got := "ausgridbot/QLD1/actual", config["state_topic"]; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if want, got := "AusGridBot Queensland", config["device"].(map[string]any)["name"]; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestMQTTWithoutDiscovery(t *testing.T) {
+	broker := &fakeBroker{messages: make(map[string]fakeMessage)}
+	m := newMQTT(broker, "ausgridbot", "")
+
+	intervals := []Interval{{SettlementDate: JSONTime{time.Now()}, RegionID: "SA1", PeriodType: "ACTUAL", RRP: 90}}
+	if err := m.PublishIntervals("SA1", intervals); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1, len(broker.messages); want != got {
+		t.Errorf("Expected %d messages, got %d", want, got)
+	}
+}
+
+func TestMQTTPeakEvent(t *testing.T) {
+	broker := &fakeBroker{messages: make(map[string]fakeMessage)}
+	m := newMQTT(broker, "ausgridbot", "homeassistant")
+
+	event := PeakEvent{Type: PeakEventPeak, RegionID: "NSW1", RRP: 1500}
+	if err := m.NotifyEvent(event, nil); err != nil {
+		t.Fatal(err)
+	}
+	var got PeakEvent
+	if msg := broker.decode("ausgridbot/NSW1/peak", &got, t); msg.retained {
+		t.Errorf("Expected peak events not to be retained")
+	}
+	if want, got := PeakEventPeak, got.Type; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"time"
+)
+
+// Notifier is somewhere a GridBot can post its toots. Mastodon is the original
+// one, but anything that can take some text and a picture will do.
+type Notifier interface {
+	// Name identifies the notifier in logs.
+	Name() string
+	PostStatus(status string) error
+	// Posts a status with an image attached, and returns the new status's ID if
+	// the service has such a thing. altText describes the image for people who
+	// can't see it. visibility is a Mastodon visibility ("public", "unlisted",
+	// etc.), notifiers without that concept ignore it.
+	PostStatusWithImageFromReader(status string, file io.Reader, altText string, visibility string) (string, error)
+}
+
+// StatusIDs are the IDs of the statuses a toot was posted as, keyed by the Name()
+// of the notifier that posted each one.
+type StatusIDs map[string]string
+
+// ReplyNotifier is a Notifier that can post a status as a reply to one it posted
+// earlier, so follow-ups are threaded with the toot they follow up on.
+type ReplyNotifier interface {
+	Notifier
+	// Works like PostStatusWithImageFromReader, but if inReplyToID isn't empty
+	// the status is a reply to that one.
+	PostReplyWithImageFromReader(status string, file io.Reader, altText string, visibility string, inReplyToID string) (string, error)
+}
+
+// EditNotifier is a Notifier that can edit a status it posted earlier.
+type EditNotifier interface {
+	Notifier
+	// Replaces the text and image of the status with the given ID.
+	EditStatusWithImageFromReader(id string, status string, file io.Reader, altText string) error
+}
+
+// LogNotifier just logs what would have been posted. It's what GridBots use in
+// test mode.
+type LogNotifier struct{}
+
+func (LogNotifier) Name() string {
+	return "log"
+}
+
+func (LogNotifier) PostStatus(status string) error {
+	slog.Info("Would toot", "toot", status)
+	return nil
+}
+
+func (LogNotifier) PostStatusWithImageFromReader(status string, file io.Reader, altText string, visibility string) (string, error) {
+	slog.Info("Would toot", "toot", status, "visibility", visibility)
+	return "", nil
+}
+
+type PeakEventType string
+
+const (
+	PeakEventPeak      PeakEventType = "peak"
+	PeakEventDowngrade PeakEventType = "downgrade"
+	PeakEventCancelled PeakEventType = "cancelled"
+	PeakEventOutcome   PeakEventType = "outcome"
+
+	PeakEventTrough          PeakEventType = "trough"
+	PeakEventTroughUpdate    PeakEventType = "trough_update"
+	PeakEventTroughCancelled PeakEventType = "trough_cancelled"
+)
+
+type ForecastPoint struct {
+	Time time.Time `json:"time"`
+	RRP  float64   `json:"rrp"`
+}
+
+// PeakEvent is the structured version of a peak or trough toot, for notifiers
+// that are read by machines rather than people.
+type PeakEvent struct {
+	Type     PeakEventType `json:"type"`
+	RegionID RegionID      `json:"region"`
+	// RRP is the new peak price in $/MWh, or the lowest price in a trough. For a
+	// peak cancellation it's the new, uninteresting, peak, and for an outcome it's
+	// the highest half hourly price that actually happened.
+	RRP float64 `json:"rrp"`
+	// PreviousRRP is the peak or trough price we last announced, if any.
+	PreviousRRP float64 `json:"previous_rrp"`
+	// PeakTime is when the peak, or the bottom of the trough, is forecast. For a
+	// cancellation it's when the cancelled one was going to be, and for an outcome
+	// it's when the actual peak was.
+	PeakTime time.Time `json:"peak_time"`
+	// The stretch of time prices are above the peak exit threshold, or below the
+	// trough threshold, and their average over it.
+	AverageRRP  float64         `json:"average_rrp,omitempty"`
+	WindowStart *time.Time      `json:"window_start,omitempty"`
+	WindowEnd   *time.Time      `json:"window_end,omitempty"`
+	Forecast    []ForecastPoint `json:"forecast"`
+	// The actual prices over the forecast, for an outcome.
+	Actual  []ForecastPoint `json:"actual,omitempty"`
+	Message string          `json:"message"`
+	// ImageDescription describes the plot that goes with the event, as alt text.
+	ImageDescription string `json:"image_description,omitempty"`
+}
+
+// EventNotifier is a Notifier that would rather have the PeakEvent than the toot
+// text when there is one.
+type EventNotifier interface {
+	Notifier
+	NotifyEvent(e PeakEvent, image []byte) error
+}
+
+// IntervalObserver is a Notifier that wants to see every interval for its
+// GridBot's region, actuals included, not just the announcements.
+type IntervalObserver interface {
+	Notifier
+	ObserveInterval(i Interval)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"sort"
+	"time"
+)
+
+const PEAK_EVENTUATED_TOOT_FORMAT = "The %s wholesale electricity price peak eventuated. Prices reached %s at %s, against a forecast of %s at %s, so the forecast was out by %s: " + AEMO_VISUALISATION_URL
+const PEAK_DIDNT_EVENTUATE_TOOT_FORMAT = "The %s wholesale electricity price peak didn't eventuate. Prices only reached %s at %s, against a forecast of %s at %s, so the forecast was out by %s: " + AEMO_VISUALISATION_URL
+
+// How long to hold on to actual prices. This needs to cover the forecast we
+// tooted about a peak with, which can be eight hours before the peak.
+const ACTUALS_RETENTION = 12 * time.Hour
+
+// How much of the actual prices leading up to now go on the plot attached to
+// toots.
+const PLOT_ACTUALS_HISTORY = 2 * time.Hour
+
+// How long after a peak window to keep waiting for the actuals before giving up
+// on following it up.
+const OUTCOME_TIMEOUT = 6 * time.Hour
+
+// TootedPeak is a peak window we've tooted about, along with what we need to
+// follow it up once it's over.
+type TootedPeak struct {
+	PriceWindow
+	Forecast  []ForecastPoint `json:"Forecast,omitempty"`  // The forecast as of the last toot about the window.
+	StatusIDs StatusIDs       `json:"StatusIDs,omitempty"` // The first toot about the window, by notifier.
+}
+
+// Remembers an actual interval, and forgets the ones older than ACTUALS_RETENTION.
+func (gb *GridBot) recordActual(i Interval) {
+	if !i.SettlementDate.Before(gb.latestActual.SettlementDate.Time) {
+		gb.latestActual = i
+	}
+	gb.actuals[i.SettlementDate.Unix()] = i
+	cutoff := gb.latestActual.SettlementDate.Add(-ACTUALS_RETENTION)
+	for k, a := range gb.actuals {
+		if a.SettlementDate.Before(cutoff) {
+			delete(gb.actuals, k)
+		}
+	}
+}
+
+// Returns the actual intervals settled after start and up to end, in time order.
+func (gb *GridBot) actualsBetween(start, end time.Time) []Interval {
+	actuals := make([]Interval, 0)
+	for _, a := range gb.actuals {
+		if a.SettlementDate.After(start) && !a.SettlementDate.After(end) {
+			actuals = append(actuals, a)
+		}
+	}
+	sort.Slice(actuals, func(i, j int) bool {
+		return actuals[i].SettlementDate.Before(actuals[j].SettlementDate.Time)
+	})
+	return actuals
+}
+
+// Works out what prices actually did over a peak window. Actuals come in five
+// minute intervals, so they're averaged over each half hour to compare like for
+// like with the forecast. ok is false until the actuals cover the whole window.
+func (gb *GridBot) peakOutcome(p TootedPeak) (actual PriceWindow, ok bool) {
+	if gb.latestActual.SettlementDate.Before(p.End) {
+		return PriceWindow{}, false
+	}
+	actual = PriceWindow{Start: p.Start, End: p.End}
+	count := 0
+	for end := p.Start.Add(FORECAST_INTERVAL_LENGTH); !end.After(p.End); end = end.Add(FORECAST_INTERVAL_LENGTH) {
+		intervals := gb.actualsBetween(end.Add(-FORECAST_INTERVAL_LENGTH), end)
+		if len(intervals) == 0 {
+			continue
+		}
+		var rrp float64
+		for _, i := range intervals {
+			rrp += i.RRP
+		}
+		rrp /= float64(len(intervals))
+		if count == 0 || rrp > actual.RRP {
+			actual.RRP = rrp
+			actual.RRPTime = end
+		}
+		actual.AverageRRP += rrp
+		count++
+	}
+	if count == 0 {
+		return PriceWindow{}, false
+	}
+	actual.AverageRRP /= float64(count)
+	return actual, true
+}
+
+// Follows up each peak window that's passed with how it actually turned out,
+// once the actuals for it are in.
+func (gb *GridBot) considerPostingOutcomes() {
+	if len(gb.pendingOutcomes) == 0 {
+		return
+	}
+	pending := make([]TootedPeak, 0, len(gb.pendingOutcomes))
+	for _, p := range gb.pendingOutcomes {
+		actual, ok := gb.peakOutcome(p)
+		if ok {
+			gb.tootPeakOutcome(p, actual)
+		} else if gb.now().Sub(p.End) < OUTCOME_TIMEOUT {
+			pending = append(pending, p)
+		} else {
+			slog.Warn("Gave up waiting for actuals to follow up a peak", "region", gb.regionString, "peakTime", p.RRPTime)
+		}
+	}
+	changed := len(pending) != len(gb.pendingOutcomes)
+	gb.pendingOutcomes = pending
+	if changed {
+		gb.saveState()
+	}
+}
+
+// Replies to the toot about a peak with what actually happened, and a plot of
+// the actual prices over the forecast we tooted.
+func (gb *GridBot) tootPeakOutcome(p TootedPeak, actual PriceWindow) {
+	format := PEAK_DIDNT_EVENTUATE_TOOT_FORMAT
+	if actual.RRP > gb.cfg.PeakExitRRP {
+		format = PEAK_EVENTUATED_TOOT_FORMAT
+	}
+	units := gb.cfg.Templates.Units
+	forecastError := math.Abs(actual.RRP - p.RRP)
+	toot := fmt.Sprintf(format, gb.regionString, Price{RRP: actual.RRP, Units: units}, gb.clock(actual.RRPTime), Price{RRP: p.RRP, Units: units}, gb.clock(p.RRPTime), Price{RRP: forecastError, Units: units})
+
+	event := PeakEvent{
+		Type:        PeakEventOutcome,
+		RegionID:    gb.cfg.RegionID,
+		RRP:         actual.RRP,
+		PreviousRRP: p.RRP,
+		PeakTime:    actual.RRPTime,
+		AverageRRP:  actual.AverageRRP,
+		WindowStart: &p.Start,
+		WindowEnd:   &p.End,
+		Forecast:    p.Forecast,
+	}
+	if len(p.Forecast) > 0 {
+		for _, a := range gb.actualsBetween(p.Forecast[0].Time.Add(-FORECAST_INTERVAL_LENGTH), p.Forecast[len(p.Forecast)-1].Time) {
+			event.Actual = append(event.Actual, ForecastPoint{Time: a.SettlementDate.Time, RRP: a.RRP})
+		}
+	}
+
+	event.ImageDescription = DescribePrices("actual wholesale electricity prices", event.Actual, gb.location, units) +
+		fmt.Sprintf(" A dashed line shows the forecast, which peaked at %s at %s.", Price{RRP: p.RRP, Units: units}, gb.clock(p.RRPTime))
+
+	buffer := new(bytes.Buffer)
+	if err := PlotOutcome(event.Forecast, event.Actual, gb.location, gb.plotOptions(), buffer); err != nil {
+		slog.Error("Failed to plot peak outcome", "region", gb.regionString, "err", err)
+	}
+	gb.postEventWithImage(toot, event, buffer.Bytes(), p.StatusIDs, "")
+}
+
+// Plots the actual prices over the forecast, with the time axis in the given
+// location.
+func PlotOutcome(forecast, actual []ForecastPoint, location *time.Location, options PlotOptions, writer io.Writer) error {
+	theme := options.theme()
+	lines := []PlotLine{
+		{Label: "Forecast", Color: theme.Forecast, Dashed: true},
+		{Label: "Actual", Color: theme.Actual},
+	}
+	for n, points := range [][]ForecastPoint{forecast, actual} {
+		for _, p := range points {
+			lines[n].Times = append(lines[n].Times, p.Time.In(location))
+			lines[n].Values = append(lines[n].Values, p.RRP)
+		}
+	}
+	return GetLinesPlot("Energy price forecast and actual", lines, options, writer)
+}
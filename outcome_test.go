@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Returns five minute actual intervals for each price, the first ending five
+// minutes after start.
+func NewActualRun(regionID RegionID, start time.Time, rrps ...float64) []Interval {
+	intervals := make([]Interval, len(rrps))
+	for n, rrp := range rrps {
+		intervals[n] = Interval{
+			SettlementDate: JSONTime{start.Add(time.Duration(n+1) * 5 * time.Minute)},
+			RegionID:       regionID,
+			Region:         string(regionID),
+			RRP:            rrp,
+			PeriodType:     "ACTUAL",
+		}
+	}
+	return intervals
+}
+
+func TestPeakOutcome(t *testing.T) {
+	gridBot, err := NewGridBot(GridBotCfg{RegionID: "SA1", TestMode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 10, 20, 17, 0, 0, 0, NEMTime)
+	peak := TootedPeak{PriceWindow: PriceWindow{Start: start, End: start.Add(time.Hour), RRP: 900, RRPTime: start.Add(time.Hour)}}
+
+	// Only the first half hour is in.
+	for _, i := range NewActualRun("SA1", start, 100, 200, 300, 400, 500, 600) {
+		gridBot.processInterval(i)
+	}
+	if _, ok := gridBot.peakOutcome(peak); ok {
+		t.Fatal("Expected no outcome until the actuals cover the window")
+	}
+
+	for _, i := range NewActualRun("SA1", start.Add(FORECAST_INTERVAL_LENGTH), 1000, 1000, 1500, 1500, 2000, 2000) {
+		gridBot.processInterval(i)
+	}
+	actual, ok := gridBot.peakOutcome(peak)
+	if !ok {
+		t.Fatal("Expected an outcome")
+	}
+	if want, got := 1500.0, actual.RRP; !FloatEquals(want, got) {
+		t.Errorf("Expected %f, got %f", want, got)
+	}
+	if want, got := start.Add(time.Hour), actual.RRPTime; !want.Equal(got) {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if want, got := 925.0, actual.AverageRRP; !FloatEquals(want, got) {
+		t.Errorf("Expected %f, got %f", want, got)
+	}
+}
+
+func TestGridBotPeakOutcomeToots(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		actual float64
+		format string
+	}{
+		{"eventuated", 700, PEAK_EVENTUATED_TOOT_FORMAT},
+		{"didn't eventuate", 200, PEAK_DIDNT_EVENTUATE_TOOT_FORMAT},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			templates := DefaultTootTemplates()
+			templates.Units = UNITS_CENTS_PER_KWH
+			gridBot, err := NewGridBot(GridBotCfg{RegionID: "SA1", TestMode: true, Templates: templates})
+			if err != nil {
+				t.Fatal(err)
+			}
+			replies := newFakeReplyNotifier()
+			events := newFakeEventNotifier()
+			gridBot.notifiers = []Notifier{replies, events}
+
+			// Toot about a peak.
+			start := time.Now().Add(time.Hour).Truncate(FORECAST_INTERVAL_LENGTH)
+			gridBot.forecasts = NewForecastRun("SA1", start, 100, 900, 100)
+			gridBot.forecastsStale = false
+			gridBot.considerPostingToot()
+			replies.waitForPost(t)
+			events.waitForEvent(t)
+			if want, got := "", <-replies.inReplyTo; want != got {
+				t.Errorf("Expected %q, got %q", want, got)
+			}
+			if want, got := "1", gridBot.tootedPeaks[0].StatusIDs["fake"]; want != got {
+				t.Fatalf("Expected %s, got %s", want, got)
+			}
+
+			// Wind the clock on past it.
+			peak := gridBot.tootedPeaks[0]
+			shift := -3 * time.Hour
+			peak.Start, peak.End, peak.RRPTime = peak.Start.Add(shift), peak.End.Add(shift), peak.RRPTime.Add(shift)
+			for n := range peak.Forecast {
+				peak.Forecast[n].Time = peak.Forecast[n].Time.Add(shift)
+			}
+			gridBot.tootedPeaks[0] = peak
+			gridBot.forecasts = NewForecastRun("SA1", start, 100, 100, 100)
+			gridBot.considerPostingToot()
+			if want, got := 0, len(gridBot.tootedPeaks); want != got {
+				t.Fatalf("Expected %d, got %d", want, got)
+			}
+
+			// Nothing to say until the actuals are in.
+			gridBot.lastToot = ""
+			gridBot.considerPostingOutcomes()
+			if gridBot.lastToot != "" {
+				t.Fatalf("Expected no toot, got %q", gridBot.lastToot)
+			}
+
+			rrps := make([]float64, 6)
+			for n := range rrps {
+				rrps[n] = tt.actual
+			}
+			for _, i := range NewActualRun("SA1", peak.Start, rrps...) {
+				gridBot.processInterval(i)
+			}
+			gridBot.considerPostingOutcomes()
+			price := func(rrp float64) Price {
+				return Price{RRP: rrp, Units: UNITS_CENTS_PER_KWH}
+			}
+			want := fmt.Sprintf(tt.format, "South Australia", price(tt.actual), gridBot.clock(peak.End), price(900), gridBot.clock(peak.RRPTime), price(900-tt.actual))
+			if got := gridBot.lastToot; want != got {
+				t.Errorf("Expected %s, got %s", want, got)
+			}
+			if want, got := want, replies.waitForPost(t).status; want != got {
+				t.Errorf("Expected %s, got %s", want, got)
+			}
+			if want, got := "1", <-replies.inReplyTo; want != got {
+				t.Errorf("Expected a reply to %s, got %s", want, got)
+			}
+			e := events.waitForEvent(t)
+			if want, got := PeakEventOutcome, e.Type; want != got {
+				t.Errorf("Expected %s, got %s", want, got)
+			}
+			if want, got := 6, len(e.Actual); want != got {
+				t.Errorf("Expected %d, got %d", want, got)
+			}
+			if want, got := 0, len(gridBot.pendingOutcomes); want != got {
+				t.Errorf("Expected %d, got %d", want, got)
+			}
+		})
+	}
+}
+
+// A window that was underway when the forecast last changed is followed up over
+// the whole of it, as it was tooted, not just the part that was left.
+func TestGridBotPeakOutcomeOfWindowUnderway(t *testing.T) {
+	gridBot, err := NewGridBot(GridBotCfg{RegionID: "SA1", TestMode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := newFakeEventNotifier()
+	gridBot.notifiers = []Notifier{events}
+
+	start := time.Now().Add(time.Hour).Truncate(FORECAST_INTERVAL_LENGTH)
+	at := func(n int) time.Time {
+		return start.Add(time.Duration(n) * FORECAST_INTERVAL_LENGTH)
+	}
+	for _, step := range []struct {
+		now  time.Time
+		rrps []float64
+	}{
+		{start, []float64{100, 900, 1500, 800, 100}},
+		// Past the peak, with only the tail end of the window left.
+		{at(3).Add(10 * time.Minute), []float64{800, 100, 100}},
+		// And out the other side.
+		{at(4).Add(10 * time.Minute), []float64{100, 100}},
+	} {
+		gridBot.now = func() time.Time { return step.now }
+		gridBot.forecasts = NewForecastRun("SA1", step.now.Truncate(FORECAST_INTERVAL_LENGTH), step.rrps...)
+		gridBot.forecastsStale = false
+		gridBot.considerPostingToot()
+	}
+	if want, got := PeakEventPeak, events.waitForEvent(t).Type; want != got {
+		t.Fatalf("Expected %s, got %s", want, got)
+	}
+	if want, got := 1, len(gridBot.pendingOutcomes); want != got {
+		t.Fatalf("Expected %d, got %d", want, got)
+	}
+
+	// The peak came in a bit higher than forecast, before the last forecast.
+	rrps := []float64{}
+	for _, rrp := range []float64{900, 1600, 700} {
+		for n := 0; n < 6; n++ {
+			rrps = append(rrps, rrp)
+		}
+	}
+	for _, i := range NewActualRun("SA1", at(1), rrps...) {
+		gridBot.processInterval(i)
+	}
+	gridBot.considerPostingOutcomes()
+	e := events.waitForEvent(t)
+	if want, got := PeakEventOutcome, e.Type; want != got {
+		t.Fatalf("Expected %s, got %s", want, got)
+	}
+	if want, got := 1600.0, e.RRP; !FloatEquals(want, got) {
+		t.Errorf("Expected %f, got %f", want, got)
+	}
+	if want, got := at(3), e.PeakTime; !want.Equal(got) {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if e.WindowStart == nil || !e.WindowStart.Equal(at(1)) {
+		t.Errorf("Expected the window to start at %s, got %v", at(1), e.WindowStart)
+	}
+	want := fmt.Sprintf(PEAK_EVENTUATED_TOOT_FORMAT, "South Australia", Price{RRP: 1600}, gridBot.clock(at(3)), Price{RRP: 1500}, gridBot.clock(at(3)), Price{RRP: 100})
+	if got := e.Message; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+	"gonum.org/v1/plot/vg/vgimg"
+	"gonum.org/v1/plot/vg/vgpdf"
+	"gonum.org/v1/plot/vg/vgsvg"
+)
+
+// The formats plots can be written out as.
+const (
+	PLOT_FORMAT_PNG = "png"
+	PLOT_FORMAT_SVG = "svg"
+	PLOT_FORMAT_PDF = "pdf"
+)
+
+// The colour themes plots can be drawn in.
+const (
+	PLOT_THEME_LIGHT = "light"
+	PLOT_THEME_DARK  = "dark"
+)
+
+// The MIME type of each plot format, for serving them over HTTP.
+var plotContentTypes = map[string]string{
+	PLOT_FORMAT_PNG: "image/png",
+	PLOT_FORMAT_SVG: "image/svg+xml",
+	PLOT_FORMAT_PDF: "application/pdf",
+}
+
+// PlotOptions say how a plot looks and what it's written out as. The zero value
+// is a light PNG the size of the ones attached to toots.
+type PlotOptions struct {
+	Format string    // PLOT_FORMAT_PNG, PLOT_FORMAT_SVG or PLOT_FORMAT_PDF. Defaults to PNG.
+	Width  vg.Length // Defaults to 6.4 inches.
+	Height vg.Length // Defaults to 3.6 inches. Each panel past the first adds half as much again.
+	DPI    int       // Only matters for PNGs. Defaults to 96.
+	Theme  string    // PLOT_THEME_LIGHT or PLOT_THEME_DARK. Defaults to light.
+	Units  string    // The units prices are shown in. Defaults to UNITS_DOLLARS_PER_KWH.
+}
+
+// Fills in the defaults for any options that aren't set.
+func (o PlotOptions) withDefaults() PlotOptions {
+	if o.Format == "" {
+		o.Format = PLOT_FORMAT_PNG
+	}
+	if o.Width == 0 {
+		o.Width = plot_scalar * plot_aspect_x * vg.Inch
+	}
+	if o.Height == 0 {
+		o.Height = plot_scalar * plot_aspect_y * vg.Inch
+	}
+	if o.DPI == 0 {
+		o.DPI = vgimg.DefaultDPI
+	}
+	if o.Theme == "" {
+		o.Theme = PLOT_THEME_LIGHT
+	}
+	if o.Units == "" {
+		o.Units = UNITS_DOLLARS_PER_KWH
+	}
+	return o
+}
+
+// Checks the options make sense.
+func (o PlotOptions) Validate() error {
+	o = o.withDefaults()
+	if _, ok := plotContentTypes[o.Format]; !ok {
+		return fmt.Errorf("unknown plot format: %s", o.Format)
+	}
+	if _, ok := plotThemes[o.Theme]; !ok {
+		return fmt.Errorf("unknown plot theme: %s", o.Theme)
+	}
+	if !validUnits(o.Units) {
+		return fmt.Errorf("unknown units: %s", o.Units)
+	}
+	if o.Width < 0 || o.Height < 0 || o.DPI < 0 {
+		return fmt.Errorf("plot size must not be negative")
+	}
+	return nil
+}
+
+// The theme the options pick, or the light one if they don't pick a real one.
+func (o PlotOptions) theme() PlotTheme {
+	if t, ok := plotThemes[o.withDefaults().Theme]; ok {
+		return t
+	}
+	return plotThemes[PLOT_THEME_LIGHT]
+}
+
+// PlotTheme is the colours a plot is drawn in.
+type PlotTheme struct {
+	Background color.Color
+	Foreground color.Color // The text, the axes and the demand line.
+	Grid       color.Color
+	Actual     color.Color
+	Forecast   color.Color
+	Threshold  color.Color
+	Now        color.Color
+	Shading    color.Color // Behind the peak windows.
+	Peak       color.Color // The marker on the top of each peak.
+	// The generation and interchange on the demand panel.
+	Scheduled     color.Color
+	SemiScheduled color.Color
+	Interchange   color.Color
+	Regions       map[RegionID]color.Color // Each region's line on the plot of every region.
+	OtherRegion   color.Color              // For any region that isn't in Regions.
+}
+
+var plotThemes = map[string]PlotTheme{
+	PLOT_THEME_LIGHT: {
+		Background:    color.White,
+		Foreground:    color.Black,
+		Grid:          color.Gray{Y: 128},
+		Actual:        color.RGBA{R: 255, A: 255},
+		Forecast:      color.RGBA{B: 255, A: 255},
+		Threshold:     color.RGBA{R: 255, G: 140, A: 255},
+		Now:           color.Gray{Y: 128},
+		Shading:       color.RGBA{R: 255, G: 220, B: 220, A: 255},
+		Peak:          color.RGBA{R: 200, A: 255},
+		Scheduled:     color.RGBA{R: 140, G: 70, B: 20, A: 255},
+		SemiScheduled: color.RGBA{G: 160, A: 255},
+		Interchange:   color.RGBA{R: 150, B: 200, A: 255},
+		Regions: map[RegionID]color.Color{
+			"NSW1": color.RGBA{G: 120, B: 200, A: 255},
+			"QLD1": color.RGBA{R: 128, B: 32, A: 255},
+			"SA1":  color.RGBA{R: 230, G: 120, A: 255},
+			"TAS1": color.RGBA{G: 150, B: 60, A: 255},
+			"VIC1": color.RGBA{R: 100, G: 50, B: 160, A: 255},
+		},
+		OtherRegion: color.Gray{Y: 128},
+	},
+	// Something that sits comfortably in a dark mode Mastodon client.
+	PLOT_THEME_DARK: {
+		Background:    color.RGBA{R: 25, G: 27, B: 34, A: 255},
+		Foreground:    color.Gray{Y: 230},
+		Grid:          color.Gray{Y: 70},
+		Actual:        color.RGBA{R: 255, G: 100, B: 100, A: 255},
+		Forecast:      color.RGBA{R: 110, G: 170, B: 255, A: 255},
+		Threshold:     color.RGBA{R: 255, G: 170, B: 60, A: 255},
+		Now:           color.Gray{Y: 150},
+		Shading:       color.RGBA{R: 65, G: 35, B: 42, A: 255},
+		Peak:          color.RGBA{R: 255, G: 80, B: 80, A: 255},
+		Scheduled:     color.RGBA{R: 210, G: 140, B: 80, A: 255},
+		SemiScheduled: color.RGBA{R: 90, G: 210, B: 110, A: 255},
+		Interchange:   color.RGBA{R: 210, G: 130, B: 255, A: 255},
+		Regions: map[RegionID]color.Color{
+			"NSW1": color.RGBA{R: 90, G: 180, B: 255, A: 255},
+			"QLD1": color.RGBA{R: 230, G: 90, B: 120, A: 255},
+			"SA1":  color.RGBA{R: 255, G: 170, B: 60, A: 255},
+			"TAS1": color.RGBA{R: 90, G: 210, B: 110, A: 255},
+			"VIC1": color.RGBA{R: 180, G: 140, B: 255, A: 255},
+		},
+		OtherRegion: color.Gray{Y: 150},
+	},
+}
+
+// Colours in the plot's background, text, axes and grid.
+func (t PlotTheme) apply(p *plot.Plot, grid *plotter.Grid) {
+	p.BackgroundColor = t.Background
+	p.Title.TextStyle.Color = t.Foreground
+	p.Legend.TextStyle.Color = t.Foreground
+	for _, a := range []*plot.Axis{&p.X, &p.Y} {
+		a.Color = t.Foreground
+		a.Label.TextStyle.Color = t.Foreground
+		a.Tick.Color = t.Foreground
+		a.Tick.Label.Color = t.Foreground
+	}
+	grid.Vertical.Color = t.Grid
+	grid.Horizontal.Color = t.Grid
+}
+
+// Writes the plots out stacked one above the other.
+func writePlots(plots []*plot.Plot, options PlotOptions, w io.Writer) error {
+	options = options.withDefaults()
+	if err := options.Validate(); err != nil {
+		return err
+	}
+	width, height := options.Width, options.Height*vg.Length(len(plots)+1)/2
+
+	var c vg.CanvasWriterTo
+	switch options.Format {
+	case PLOT_FORMAT_SVG:
+		c = vgsvg.New(width, height)
+	case PLOT_FORMAT_PDF:
+		c = vgpdf.New(width, height)
+	default:
+		c = vgimg.PngCanvas{Canvas: vgimg.NewWith(vgimg.UseWH(width, height), vgimg.UseDPI(options.DPI))}
+	}
+
+	// Fill in the gaps between the panels too.
+	dc := draw.New(c)
+	dc.SetColor(options.theme().Background)
+	dc.Fill(dc.Rectangle.Path())
+
+	rows := make([][]*plot.Plot, len(plots))
+	for n, p := range plots {
+		rows[n] = []*plot.Plot{p}
+	}
+	canvases := plot.Align(rows, draw.Tiles{Rows: len(plots), Cols: 1, PadY: vg.Points(4)}, dc)
+	for n, p := range plots {
+		p.Draw(canvases[n][0])
+	}
+	_, err := c.WriteTo(w)
+	return err
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlotOptions(t *testing.T) {
+	start := time.Date(2024, 1, 30, 16, 0, 0, 0, NEMTime)
+	pp := PricePlot{Location: NEMTime, Threshold: 300}
+	for n, rrp := range []float64{100, 900, 200} {
+		pp.Forecast = append(pp.Forecast, ForecastPoint{Time: start.Add(time.Duration(n) * FORECAST_INTERVAL_LENGTH), RRP: rrp})
+	}
+	plot := func(options PlotOptions) []byte {
+		t.Helper()
+		buffer := new(bytes.Buffer)
+		if err := PlotPrices(pp, options, buffer); err != nil {
+			t.Fatal(err)
+		}
+		return buffer.Bytes()
+	}
+
+	if svg := string(plot(PlotOptions{Format: PLOT_FORMAT_SVG})); !strings.Contains(svg, "<svg") {
+		t.Errorf("Expected an SVG, got %.40q", svg)
+	}
+	if pdf := string(plot(PlotOptions{Format: PLOT_FORMAT_PDF})); !strings.HasPrefix(pdf, "%PDF") {
+		t.Errorf("Expected a PDF, got %.40q", pdf)
+	}
+
+	light, err := png.Decode(bytes.NewReader(plot(PlotOptions{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dark, err := png.Decode(bytes.NewReader(plot(PlotOptions{Theme: PLOT_THEME_DARK, DPI: 192})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := light.Bounds().Dx()*2, dark.Bounds().Dx(); math.Abs(float64(want-got)) > 1 {
+		t.Errorf("Expected %d, got %d", want, got)
+	}
+	// The corners are background.
+	if r, g, b, _ := light.At(0, 0).RGBA(); r>>8 != 255 || g>>8 != 255 || b>>8 != 255 {
+		t.Errorf("Expected a white background, got %d,%d,%d", r>>8, g>>8, b>>8)
+	}
+	wr, wg, wb, _ := plotThemes[PLOT_THEME_DARK].Background.RGBA()
+	if r, g, b, _ := dark.At(0, 0).RGBA(); r != wr || g != wg || b != wb {
+		t.Errorf("Expected a dark background, got %d,%d,%d", r>>8, g>>8, b>>8)
+	}
+
+	for _, options := range []PlotOptions{{Format: "gif"}, {Theme: "sepia"}, {DPI: -1}, {Units: "bananas"}} {
+		if err := options.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", options)
+		}
+		if err := PlotPrices(pp, options, new(bytes.Buffer)); err == nil {
+			t.Errorf("Expected plotting with %+v to fail", options)
+		}
+	}
+}
+
+func TestPlotUnits(t *testing.T) {
+	for _, tt := range []struct {
+		units string
+		label string
+		scale float64
+	}{
+		{"", "Price ($/kWh)", 1.0 / 1000},
+		{UNITS_CENTS_PER_KWH, "Price (c/kWh)", 1.0 / 10},
+		{UNITS_DOLLARS_PER_MWH, "Price ($/MWh)", 1},
+	} {
+		options := PlotOptions{Units: tt.units}
+		if want, got := tt.label, newPricesPlot("", options).Y.Label.Text; want != got {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+		if want, got := tt.scale, priceScale(options); !FloatEquals(want, got) {
+			t.Errorf("Expected %f, got %f", want, got)
+		}
+	}
+}
@@ -1,144 +1,460 @@
 package main
 
 import (
+	"fmt"
 	"image/color"
 	"io"
-	"strconv"
+	"math"
+	"sort"
 	"time"
 
 	"gonum.org/v1/plot"
 	"gonum.org/v1/plot/plotter"
 	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
 )
 
 const plot_aspect_x, plot_aspect_y = 16, 9
 const plot_scalar = 0.4
 
+// PlotLine is one series on a plot. Values are in $/MWh, or MW on the demand
+// panel. Prices are shown in the units in the PlotOptions.
+type PlotLine struct {
+	Label  string // Shown in the legend, if there's more than one line.
+	Times  []time.Time
+	Values []float64
+	Color  color.Color
+	Dashed bool
+}
+
+// Plots the data against time. The time axis is labelled in the location of the
+// first label, so daylight saving changes partway through are shown correctly.
 func GetPlot(xAxisLabels []time.Time, data []float64, w io.Writer) error {
-	// create a new line instance
-	p := plot.New()
+	options := PlotOptions{}
+	return GetLinesPlot("Energy price forecast", []PlotLine{{Times: xAxisLabels, Values: data, Color: options.theme().Forecast}}, options, w)
+}
 
-	p.Title.Text = "Energy price forecast"
-	p.X.Label.Text = "Time"
-	p.Y.Label.Text = "Price ($/kWh)"
-	grid := plotter.NewGrid()
-	p.Add(grid)
+// Plots each of the lines against time on the same axes. The time axis is
+// labelled in the location of the first line's first time.
+func GetLinesPlot(title string, lines []PlotLine, options PlotOptions, w io.Writer) error {
+	p := newPricesPlot(title, options)
+
+	location := time.UTC
+	if len(lines) > 0 && len(lines[0].Times) > 0 {
+		location = lines[0].Times[0].Location()
+	}
 
-	// Add the price series as a line with no point markers
+	if err := addLines(p, lines, len(lines) > 1, priceScale(options)); err != nil {
+		return err
+	}
+	setTimeAxis(p, location, options)
+	return writePlots([]*plot.Plot{p}, options, w)
+}
+
+// PricePlot is what goes on the plot attached to peak toots. Prices are in $/MWh.
+type PricePlot struct {
+	Actual    []ForecastPoint // The recent actual prices.
+	Forecast  []ForecastPoint
+	Now       time.Time      // Marked with a vertical line, unless it's zero.
+	Threshold float64        // The price a peak gets interesting at. Not drawn if zero.
+	Peaks     []PriceWindow  // Shaded, with the highest price in each labelled.
+	Location  *time.Location // The time axis and labels are in this location.
+	Demand    []DemandPoint  // Plotted in a panel under the prices, if there are any.
+}
+
+// DemandPoint is the demand and generation in a region at a time, in MW.
+type DemandPoint struct {
+	Time          time.Time
+	Demand        float64
+	Scheduled     float64 // Generation that's dispatched to order, like coal, gas and hydro.
+	SemiScheduled float64 // Generation that depends on the weather, like wind and solar farms.
+	Interchange   float64 // The net flow over the interconnectors to other regions.
+}
+
+// Plots the actual prices leading up to now and the forecast after it, with the
+// peak threshold and the peak windows marked. If there's demand, it goes in a
+// second panel underneath on the same time axis.
+func PlotPrices(pp PricePlot, options PlotOptions, w io.Writer) error {
+	theme := options.theme()
+	units := options.withDefaults().Units
+	scale := priceScale(options)
+	p := newPricesPlot("Energy price forecast", options)
+	location := pp.Location
+	if location == nil {
+		location = time.UTC
+	}
+
+	// Work out how much of the plot the data covers, so the markers can span it.
+	var first, last time.Time
+	var low, high float64
+	points := append(append([]ForecastPoint{}, pp.Actual...), pp.Forecast...)
+	for n, point := range points {
+		if n == 0 || point.Time.Before(first) {
+			first = point.Time
+		}
+		if n == 0 || point.Time.After(last) {
+			last = point.Time
+		}
+		if n == 0 || point.RRP < low {
+			low = point.RRP
+		}
+		if n == 0 || point.RRP > high {
+			high = point.RRP
+		}
+	}
+	if len(points) > 0 && pp.Threshold != 0 {
+		low, high = math.Min(low, pp.Threshold), math.Max(high, pp.Threshold)
+	}
 
-	items := make(plotter.XYs, len(xAxisLabels))
-	for i := range xAxisLabels {
-		// add the data to the plot
-		_, tzOffset := xAxisLabels[i].Zone()
-		items[i].X = float64(xAxisLabels[i].Unix() + int64(tzOffset))
-		items[i].Y = data[i] / 1000
+	// The shading goes underneath everything else.
+	for _, peak := range pp.Peaks {
+		if len(points) == 0 {
+			break
+		}
+		shading, err := plotter.NewPolygon(plotter.XYs{
+			{X: float64(peak.Start.Unix()), Y: low * scale},
+			{X: float64(peak.End.Unix()), Y: low * scale},
+			{X: float64(peak.End.Unix()), Y: high * scale},
+			{X: float64(peak.Start.Unix()), Y: high * scale},
+		})
+		if err != nil {
+			return err
+		}
+		shading.Color = theme.Shading
+		shading.LineStyle.Width = 0
+		p.Add(shading)
 	}
 
-	if line, err := plotter.NewLine(items); err != nil {
+	lines := []PlotLine{
+		{Label: "Actual", Color: theme.Actual},
+		{Label: "Forecast", Color: theme.Forecast, Dashed: true},
+	}
+	for n, series := range [][]ForecastPoint{pp.Actual, pp.Forecast} {
+		for _, point := range series {
+			lines[n].Times = append(lines[n].Times, point.Time)
+			lines[n].Values = append(lines[n].Values, point.RRP)
+		}
+	}
+	if len(points) > 0 && pp.Threshold != 0 {
+		lines = append(lines, PlotLine{
+			Label:  "Peak threshold",
+			Times:  []time.Time{first, last},
+			Values: []float64{pp.Threshold, pp.Threshold},
+			Color:  theme.Threshold,
+			Dashed: true,
+		})
+	}
+	// Now is only marked if it's among the data, so a stale forecast doesn't
+	// stretch the time axis out to it.
+	now := pp.Now
+	if len(points) == 0 || now.Before(first) || now.After(last) {
+		now = time.Time{}
+	}
+	if !now.IsZero() {
+		lines = append(lines, PlotLine{
+			Label:  "Now",
+			Times:  []time.Time{now, now},
+			Values: []float64{low, high},
+			Color:  theme.Now,
+		})
+	}
+	if err := addLines(p, lines, true, scale); err != nil {
 		return err
-	} else {
-		line.Color = color.RGBA{B: 255, A: 255}
-		line.Width = vg.Points(1)
-		p.Add(line)
 	}
 
-	p.X.Tick.Marker = plot.TimeTicks{Format: "15:04", Ticker: myTicker{TickCount: len(xAxisLabels)}}
-	// p.Y.Tick.Marker = plot.ConstantTicks{}
+	// Mark the top of each peak with what it is and when.
+	if len(pp.Peaks) > 0 {
+		labels := plotter.XYLabels{}
+		for _, peak := range pp.Peaks {
+			labels.XYs = append(labels.XYs, plotter.XY{X: float64(peak.RRPTime.Unix()), Y: peak.RRP * scale})
+			labels.Labels = append(labels.Labels, fmt.Sprintf("%s at %s", Price{RRP: peak.RRP, Units: units}, peak.RRPTime.In(location).Format("15:04")))
+		}
+		markers, err := plotter.NewScatter(labels)
+		if err != nil {
+			return err
+		}
+		markers.GlyphStyle.Color = theme.Peak
+		markers.GlyphStyle.Shape = draw.CircleGlyph{}
+		p.Add(markers)
+		annotations, err := plotter.NewLabels(labels)
+		if err != nil {
+			return err
+		}
+		for n := range annotations.TextStyle {
+			annotations.TextStyle[n].XAlign = draw.XCenter
+			annotations.TextStyle[n].Color = theme.Foreground
+		}
+		annotations.Offset = vg.Point{Y: vg.Points(4)}
+		p.Add(annotations)
+	}
+
+	plots := []*plot.Plot{p}
+	if len(pp.Demand) > 0 {
+		d, err := plotDemand(pp.Demand, now, theme)
+		if err != nil {
+			return err
+		}
+		// Only the bottom panel needs the time axis labelled.
+		p.X.Label.Text = ""
+		plots = append(plots, d)
+	}
+
+	// Line the panels' time axes up with each other.
+	for _, p := range plots[1:] {
+		plots[0].X.Min, plots[0].X.Max = math.Min(plots[0].X.Min, p.X.Min), math.Max(plots[0].X.Max, p.X.Max)
+	}
+	for _, p := range plots {
+		p.X.Min, p.X.Max = plots[0].X.Min, plots[0].X.Max
+		setTimeAxis(p, location, options)
+	}
+	return writePlots(plots, options, w)
+}
+
+// Plots every region's prices on one chart, a line each, with the time axis in
+// NEM time. The intervals can be for any regions and in any order.
+func PlotRegions(intervals []Interval, options PlotOptions, w io.Writer) error {
+	theme := options.theme()
+	byRegion := make(map[RegionID][]Interval)
+	for _, i := range intervals {
+		byRegion[i.RegionID] = append(byRegion[i.RegionID], i)
+	}
+	regionIDs := make([]RegionID, 0, len(byRegion))
+	for regionID := range byRegion {
+		regionIDs = append(regionIDs, regionID)
+	}
+	sort.Slice(regionIDs, func(i, j int) bool {
+		return regionIDs[i] < regionIDs[j]
+	})
+
+	lines := make([]PlotLine, 0, len(regionIDs))
+	for _, regionID := range regionIDs {
+		region := byRegion[regionID]
+		sort.Slice(region, func(i, j int) bool {
+			return region[i].SettlementDate.Before(region[j].SettlementDate.Time)
+		})
+		line := PlotLine{Label: string(regionID), Color: theme.Regions[regionID]}
+		if name, err := RegionIDToRegionString(regionID); err == nil {
+			line.Label = name
+		}
+		if line.Color == nil {
+			line.Color = theme.OtherRegion
+		}
+		for _, i := range region {
+			line.Times = append(line.Times, i.SettlementDate.Time)
+			line.Values = append(line.Values, i.RRP)
+		}
+		lines = append(lines, line)
+	}
 
-	if wt, err := p.WriterTo(plot_scalar*plot_aspect_x*vg.Inch, plot_scalar*plot_aspect_y*vg.Inch, "png"); err != nil {
+	p := newPricesPlot("NEM energy prices", options)
+	if err := addLines(p, lines, true, priceScale(options)); err != nil {
 		return err
-	} else {
-		wt.WriteTo(w)
 	}
+	setTimeAxis(p, NEMTime, options)
+	return writePlots([]*plot.Plot{p}, options, w)
+}
+
+// Plots demand against the generation in the region and the interchange with
+// other regions, with a line at now unless it's zero.
+func plotDemand(points []DemandPoint, now time.Time, theme PlotTheme) (*plot.Plot, error) {
+	p := newPlot("", "Power (MW)", theme)
+
+	sorted := make([]DemandPoint, len(points))
+	copy(sorted, points)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+	lines := []PlotLine{
+		{Label: "Demand", Color: theme.Foreground},
+		{Label: "Scheduled generation", Color: theme.Scheduled},
+		{Label: "Semi-scheduled generation", Color: theme.SemiScheduled},
+		{Label: "Net interchange", Color: theme.Interchange, Dashed: true},
+	}
+	low, high := 0.0, 0.0
+	for _, point := range sorted {
+		for n, value := range []float64{point.Demand, point.Scheduled, point.SemiScheduled, point.Interchange} {
+			lines[n].Times = append(lines[n].Times, point.Time)
+			lines[n].Values = append(lines[n].Values, value)
+			low, high = math.Min(low, value), math.Max(high, value)
+		}
+	}
+	if !now.IsZero() {
+		lines = append(lines, PlotLine{Times: []time.Time{now, now}, Values: []float64{low, high}, Color: theme.Now})
+	}
+	if err := addLines(p, lines, true, 1); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Starts a plot of prices against time, labelled with the units they're in.
+func newPricesPlot(title string, options PlotOptions) *plot.Plot {
+	return newPlot(title, fmt.Sprintf("Price (%s)", options.withDefaults().Units), options.theme())
+}
+
+// What to multiply prices in $/MWh by to plot them in the options' units.
+func priceScale(options PlotOptions) float64 {
+	return Price{RRP: 1, Units: options.withDefaults().Units}.Value()
+}
 
+// Starts a plot of something against time, in the theme's colours.
+func newPlot(title, yLabel string, theme PlotTheme) *plot.Plot {
+	p := plot.New()
+	p.Title.Text = title
+	p.X.Label.Text = "Time"
+	p.Y.Label.Text = yLabel
+	grid := plotter.NewGrid()
+	theme.apply(p, grid)
+	p.Add(grid)
+	p.Legend.Top = true
+	return p
+}
+
+// Adds each of the lines to the plot with no point markers, and to the legend if
+// legend is set and they have a label. The values are multiplied by scale.
+func addLines(p *plot.Plot, lines []PlotLine, legend bool, scale float64) error {
+	for _, l := range lines {
+		if len(l.Times) == 0 {
+			continue
+		}
+		items := make(plotter.XYs, len(l.Times))
+		for i := range l.Times {
+			items[i].X = float64(l.Times[i].Unix())
+			items[i].Y = l.Values[i] * scale
+		}
+
+		line, err := plotter.NewLine(items)
+		if err != nil {
+			return err
+		}
+		line.Color = l.Color
+		line.Width = vg.Points(1)
+		if l.Dashed {
+			line.Dashes = []vg.Length{vg.Points(4), vg.Points(2)}
+		}
+		p.Add(line)
+		if legend && l.Label != "" {
+			p.Legend.Add(l.Label, line)
+		}
+	}
 	return nil
 }
 
-type myTicker struct {
-	TickCount int
+// Labels the time axis with the time of day in location, with as many labels
+// as fit across the plot.
+func setTimeAxis(p *plot.Plot, location *time.Location, options PlotOptions) {
+	p.X.Tick.Marker = timeTicker{Location: location, Width: options.withDefaults().Width}
 }
 
-func (t myTicker) Ticks(min, max float64) []plot.Tick {
-	ticks := make([]plot.Tick, t.TickCount)
-	for i := range ticks {
-		ticks[i].Value = min + (max-min)*float64(i)/float64(len(ticks)-1)
-		ticks[i].Label = strconv.FormatFloat(ticks[i].Value, 'f', -1, 64)
+// How far prices have to move, in $/MWh, for DescribePrices to call it a trend.
+const TREND_THRESHOLD_RRP = 20
+
+// Describes a plot of prices for people who can't see it: the time it covers, the
+// highest and lowest prices and when they are, and which way prices are heading.
+// what is what the prices are, like "forecast wholesale electricity prices".
+// Times are in location and prices in units.
+func DescribePrices(what string, points []ForecastPoint, location *time.Location, units string) string {
+	if len(points) == 0 {
+		return fmt.Sprintf("Chart of %s, with no prices to show.", what)
 	}
+	sorted := make([]ForecastPoint, len(points))
+	copy(sorted, points)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
 
-	return ticks
+	first, last := sorted[0], sorted[len(sorted)-1]
+	high, low := first, first
+	for _, p := range sorted {
+		if p.RRP > high.RRP {
+			high = p
+		}
+		if p.RRP < low.RRP {
+			low = p
+		}
+	}
+	clock := func(t time.Time) string {
+		return t.In(location).Format("15:04")
+	}
+	price := func(rrp float64) string {
+		return Price{RRP: rrp, Units: units}.String()
+	}
+
+	trend := "staying about level"
+	if last.RRP-first.RRP > TREND_THRESHOLD_RRP {
+		trend = "rising"
+	} else if first.RRP-last.RRP > TREND_THRESHOLD_RRP {
+		trend = "falling"
+	}
+	return fmt.Sprintf("Chart of %s from %s to %s. The highest is %s at %s and the lowest is %s at %s. Prices go from %s to %s, %s overall.",
+		what, clock(first.Time), clock(last.Time),
+		price(high.RRP), clock(high.Time), price(low.RRP), clock(low.Time),
+		price(first.RRP), price(last.RRP), trend)
+}
+
+// How much room, along the time axis, each tick label gets.
+var TIME_TICK_LABEL_SPACING = vg.Points(45)
+
+// The gaps between major ticks timeTicker picks from, smallest first.
+var timeTickSteps = []time.Duration{
+	30 * time.Minute,
+	time.Hour,
+	2 * time.Hour,
+	3 * time.Hour,
+	6 * time.Hour,
+	12 * time.Hour,
+	24 * time.Hour,
 }
 
-// func (myTicker) Ticks2(min, max float64) []plot.Tick {
-// 	if max <= min {
-// 		panic("illegal range")
-// 	}
-
-// 	const suggestedTicks = 3
-
-// 	labels, step, q, mag := talbotLinHanrahan(min, max, suggestedTicks, withinData, nil, nil, nil)
-// 	majorDelta := step * math.Pow10(mag)
-// 	if q == 0 {
-// 		// Simple fall back was chosen, so
-// 		// majorDelta is the label distance.
-// 		majorDelta = labels[1] - labels[0]
-// 	}
-
-// 	// Choose a reasonable, but ad
-// 	// hoc formatting for labels.
-// 	fc := byte('f')
-// 	var off int
-// 	if mag < -1 || 6 < mag {
-// 		off = 1
-// 		fc = 'g'
-// 	}
-// 	if math.Trunc(q) != q {
-// 		off += 2
-// 	}
-// 	prec := minInt(6, maxInt(off, -mag))
-// 	ticks := make([]Tick, len(labels))
-// 	for i, v := range labels {
-// 		ticks[i] = Tick{Value: v, Label: strconv.FormatFloat(v, fc, prec, 64)}
-// 	}
-
-// 	var minorDelta float64
-// 	// See talbotLinHanrahan for the values used here.
-// 	switch step {
-// 	case 1, 2.5:
-// 		minorDelta = majorDelta / 5
-// 	case 2, 3, 4, 5:
-// 		minorDelta = majorDelta / step
-// 	default:
-// 		if majorDelta/2 < dlamchP {
-// 			return ticks
-// 		}
-// 		minorDelta = majorDelta / 2
-// 	}
-
-// 	// Find the first minor tick not greater
-// 	// than the lowest data value.
-// 	var i float64
-// 	for labels[0]+(i-1)*minorDelta > min {
-// 		i--
-// 	}
-// 	// Add ticks at minorDelta intervals when
-// 	// they are not within minorDelta/2 of a
-// 	// labelled tick.
-// 	for {
-// 		val := labels[0] + i*minorDelta
-// 		if val > max {
-// 			break
-// 		}
-// 		found := false
-// 		for _, t := range ticks {
-// 			if math.Abs(t.Value-val) < minorDelta/2 {
-// 				found = true
-// 			}
-// 		}
-// 		if !found {
-// 			ticks = append(ticks, Tick{Value: val})
-// 		}
-// 		i++
-// 	}
-
-// 	return ticks
-// }
+// timeTicker puts labelled ticks on the time axis at whole hours or half hours in
+// Location, as close together as fit across Width, with unlabelled ticks on the
+// half hours in between. Midnight is labelled with the date instead of 00:00.
+type timeTicker struct {
+	Location *time.Location
+	Width    vg.Length
+}
+
+func (t timeTicker) Ticks(min, max float64) []plot.Tick {
+	if math.IsInf(min, 0) || math.IsInf(max, 0) || math.IsNaN(min) || math.IsNaN(max) || max < min {
+		return nil
+	}
+	location := t.Location
+	if location == nil {
+		location = time.UTC
+	}
+	start := time.Unix(int64(math.Ceil(min)), 0).In(location)
+	end := time.Unix(int64(math.Floor(max)), 0).In(location)
+
+	labels := int(t.Width / TIME_TICK_LABEL_SPACING)
+	step := timeTickSteps[len(timeTickSteps)-1]
+	for _, s := range timeTickSteps {
+		if int(end.Sub(start)/s)+1 <= labels {
+			step = s
+			break
+		}
+	}
+
+	// Work through each local day in wall clock time rather than adding durations,
+	// so the ticks stay on the hour either side of a daylight saving change.
+	ticks := make([]plot.Tick, 0)
+	seen := make(map[int64]bool)
+	for day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, location); !day.After(end); day = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, location) {
+		for minutes := 0; minutes < 24*60; minutes += 30 {
+			tick := time.Date(day.Year(), day.Month(), day.Day(), 0, minutes, 0, 0, location)
+			if tick.Before(start) || tick.After(end) || seen[tick.Unix()] {
+				continue
+			}
+			seen[tick.Unix()] = true
+			// Steps of a day or less divide evenly into one, so this lines them up
+			// with local midnight.
+			if time.Duration(minutes)*time.Minute%step != 0 {
+				ticks = append(ticks, plot.Tick{Value: float64(tick.Unix())})
+			} else if minutes == 0 {
+				ticks = append(ticks, plot.Tick{Value: float64(tick.Unix()), Label: tick.Format("2 Jan")})
+			} else {
+				ticks = append(ticks, plot.Tick{Value: float64(tick.Unix()), Label: tick.Format("15:04")})
+			}
+		}
+	}
+	return ticks
+}
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"image/png"
+	"math"
 	"os"
+	"strings"
 	"testing"
 	"time"
+
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/vg"
 )
 
 func TestGetPlot(t *testing.T) {
@@ -69,3 +76,207 @@ func TestPlotData(t *testing.T) {
 	defer file.Close()
 	GetPlot(labels, values, file)
 }
+
+func TestPlotRegions(t *testing.T) {
+	f, err := os.Open("data/exampledata.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var aemoData AEMOData
+	if err := json.NewDecoder(f).Decode(&aemoData); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Create("test.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := PlotRegions(aemoData.Intervals, PlotOptions{}, file); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlotPrices(t *testing.T) {
+	now := time.Date(2024, 1, 30, 16, 2, 0, 0, NEMTime)
+	pp := PricePlot{Now: now, Threshold: 300, Location: NEMTime}
+	for n, rrp := range []float64{90, 95, 110, 120, 150, 140} {
+		pp.Actual = append(pp.Actual, ForecastPoint{Time: now.Truncate(5 * time.Minute).Add(time.Duration(n-5) * 5 * time.Minute), RRP: rrp})
+	}
+	for n, rrp := range []float64{150, 280, 900, 1500, 400, 200} {
+		pp.Forecast = append(pp.Forecast, ForecastPoint{Time: now.Truncate(FORECAST_INTERVAL_LENGTH).Add(time.Duration(n+1) * FORECAST_INTERVAL_LENGTH), RRP: rrp})
+	}
+	pp.Peaks = []PriceWindow{{Start: pp.Forecast[1].Time, End: pp.Forecast[4].Time, RRP: 1500, RRPTime: pp.Forecast[3].Time, AverageRRP: 933}}
+
+	file, err := os.Create("test.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := PlotPrices(pp, PlotOptions{Units: UNITS_CENTS_PER_KWH}, file); err != nil {
+		t.Fatal(err)
+	}
+
+	// The demand panel makes the plot taller, on the same time axis.
+	var single, stacked bytes.Buffer
+	if err := PlotPrices(pp, PlotOptions{}, &single); err != nil {
+		t.Fatal(err)
+	}
+	for n, p := range append(append([]ForecastPoint{}, pp.Actual...), pp.Forecast...) {
+		pp.Demand = append(pp.Demand, DemandPoint{Time: p.Time, Demand: 6000 + float64(n)*100, Scheduled: 5000, SemiScheduled: 1500 - float64(n)*100, Interchange: -500})
+	}
+	if err := PlotPrices(pp, PlotOptions{}, &stacked); err != nil {
+		t.Fatal(err)
+	}
+	singleImage, err := png.Decode(&single)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stackedImage, err := png.Decode(&stacked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := singleImage.Bounds().Dx(), stackedImage.Bounds().Dx(); want != got {
+		t.Errorf("Expected %d, got %d", want, got)
+	}
+	if want, got := singleImage.Bounds().Dy()*3/2, stackedImage.Bounds().Dy(); math.Abs(float64(want-got)) > 1 {
+		t.Errorf("Expected %d, got %d", want, got)
+	}
+
+	// There's nothing to plot before the first forecast comes in.
+	if err := PlotPrices(PricePlot{Now: now, Threshold: 300}, PlotOptions{}, new(bytes.Buffer)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDescribePrices(t *testing.T) {
+	start := time.Date(2024, 1, 30, 16, 0, 0, 0, NEMTime)
+	points := func(rrps ...float64) []ForecastPoint {
+		p := make([]ForecastPoint, len(rrps))
+		for n, rrp := range rrps {
+			p[n] = ForecastPoint{Time: start.Add(time.Duration(n) * FORECAST_INTERVAL_LENGTH), RRP: rrp}
+		}
+		// Order shouldn't matter.
+		p[0], p[len(p)-1] = p[len(p)-1], p[0]
+		return p
+	}
+	for _, tt := range []struct {
+		name   string
+		points []ForecastPoint
+		units  string
+		want   string
+	}{
+		{"rising", points(100, 1500, 300, 200), UNITS_DOLLARS_PER_KWH, "Chart of prices from 16:00 to 17:30. The highest is $1.50/kWh at 16:30 and the lowest is $0.10/kWh at 16:00. Prices go from $0.10/kWh to $0.20/kWh, rising overall."},
+		{"falling", points(300, 50, 100), UNITS_CENTS_PER_KWH, "Chart of prices from 16:00 to 17:00. The highest is 30.00c/kWh at 16:00 and the lowest is 5.00c/kWh at 16:30. Prices go from 30.00c/kWh to 10.00c/kWh, falling overall."},
+		{"level", points(100, -20, 110), UNITS_DOLLARS_PER_MWH, "Chart of prices from 16:00 to 17:00. The highest is $110.00/MWh at 17:00 and the lowest is -$20.00/MWh at 16:30. Prices go from $100.00/MWh to $110.00/MWh, staying about level overall."},
+		{"empty", nil, UNITS_DOLLARS_PER_KWH, "Chart of prices, with no prices to show."},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if want, got := tt.want, DescribePrices("prices", tt.points, NEMTime, tt.units); want != got {
+				t.Errorf("Expected %s, got %s", want, got)
+			}
+		})
+	}
+}
+
+func TestTimeTicker(t *testing.T) {
+	brisbane, err := RegionLocation("QLD1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	adelaide, err := RegionLocation("SA1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sydney, err := RegionLocation("NSW1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	width := plot_scalar * plot_aspect_x * vg.Inch
+	labels := func(ticks []plot.Tick) []string {
+		l := make([]string, 0)
+		for _, tick := range ticks {
+			if tick.Label != "" {
+				l = append(l, tick.Label)
+			}
+		}
+		return l
+	}
+	for _, tc := range []struct {
+		name       string
+		start, end time.Time
+		location   *time.Location
+		width      vg.Length
+		want       []string
+		ticks      int
+	}{
+		{
+			name:     "half hours",
+			start:    time.Date(2024, 1, 30, 16, 10, 0, 0, brisbane),
+			end:      time.Date(2024, 1, 30, 19, 50, 0, 0, brisbane),
+			location: brisbane,
+			width:    width,
+			want:     []string{"16:30", "17:00", "17:30", "18:00", "18:30", "19:00", "19:30"},
+			ticks:    7,
+		},
+		{
+			name:     "thinned to fit",
+			start:    time.Date(2024, 1, 30, 16, 10, 0, 0, brisbane),
+			end:      time.Date(2024, 1, 30, 19, 50, 0, 0, brisbane),
+			location: brisbane,
+			width:    width / 3,
+			want:     []string{"18:00"},
+			ticks:    7,
+		},
+		{
+			name:     "over midnight",
+			start:    time.Date(2024, 1, 30, 14, 0, 0, 0, brisbane),
+			end:      time.Date(2024, 1, 31, 8, 0, 0, 0, brisbane),
+			location: brisbane,
+			width:    width,
+			want:     []string{"14:00", "16:00", "18:00", "20:00", "22:00", "31 Jan", "02:00", "04:00", "06:00", "08:00"},
+			ticks:    37,
+		},
+		{
+			// Adelaide is half an hour off the NEM's time, so its hours are too.
+			name:     "local hours",
+			start:    time.Date(2024, 1, 30, 16, 0, 0, 0, NEMTime),
+			end:      time.Date(2024, 1, 30, 18, 0, 0, 0, NEMTime),
+			location: adelaide,
+			width:    width / 3,
+			want:     []string{"17:00", "18:00"},
+			ticks:    5,
+		},
+		{
+			// Daylight saving starts at 02:00, which becomes 03:00.
+			name:     "daylight saving",
+			start:    time.Date(2024, 10, 6, 0, 30, 0, 0, sydney),
+			end:      time.Date(2024, 10, 6, 5, 0, 0, 0, sydney),
+			location: sydney,
+			width:    width / 2,
+			want:     []string{"01:00", "03:00", "04:00", "05:00"},
+			ticks:    8,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ticks := timeTicker{Location: tc.location, Width: tc.width}.Ticks(float64(tc.start.Unix()), float64(tc.end.Unix()))
+			if want, got := strings.Join(tc.want, ","), strings.Join(labels(ticks), ","); want != got {
+				t.Errorf("Expected %s, got %s", want, got)
+			}
+			if want, got := tc.ticks, len(ticks); want != got {
+				t.Errorf("Expected %d, got %d", want, got)
+			}
+			for _, tick := range ticks {
+				if minute := time.Unix(int64(tick.Value), 0).In(tc.location).Minute(); minute%30 != 0 {
+					t.Errorf("Expected ticks on the half hour, got one at %d past", minute)
+				}
+			}
+		})
+	}
+
+	if ticks := (timeTicker{Location: brisbane, Width: width}).Ticks(math.Inf(1), math.Inf(-1)); len(ticks) != 0 {
+		t.Errorf("Expected no ticks for an empty plot, got %d", len(ticks))
+	}
+}
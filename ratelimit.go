@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// How many times to try a request that keeps getting rate limited.
+const RATE_LIMIT_ATTEMPTS = 3
+
+// The longest we'll wait on rate limits for a single post, all up. Posts are
+// sent from the GridBot's main loop, so it's better to drop one than to hold
+// everything else up for minutes.
+const RATE_LIMIT_MAX_WAIT = 30 * time.Second
+
+// retryAfterFunc looks at a response and says how long the server wants us to
+// wait before trying again, or 0 if it isn't asking us to wait.
+type retryAfterFunc func(resp *http.Response, body []byte) time.Duration
+
+// retryAfterHeader reads the standard Retry-After header, in seconds.
+func retryAfterHeader(resp *http.Response) time.Duration {
+	if s, err := strconv.ParseFloat(resp.Header.Get("Retry-After"), 64); err == nil && s > 0 {
+		return time.Duration(s * float64(time.Second))
+	}
+	return 0
+}
+
+// Sends a request, and if the server says we're being rate limited waits as long
+// as it asks and sends it again. newReq is called for every attempt because a
+// request body can only be read once. Gives up rather than waiting more than
+// maxWait in total. Returns the final response's body.
+func doHonouringRetryAfter(client *http.Client, newReq func() (*http.Request, error), retryAfter retryAfterFunc, sleep func(time.Duration), maxWait time.Duration) (*http.Response, []byte, error) {
+	waited := time.Duration(0)
+	for attempt := 1; ; attempt++ {
+		req, err := newReq()
+		if err != nil {
+			return nil, nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		if resp.StatusCode != http.StatusTooManyRequests {
+			return resp, body, nil
+		}
+		wait := retryAfter(resp, body)
+		if attempt == RATE_LIMIT_ATTEMPTS {
+			return nil, nil, fmt.Errorf("still rate limited after %d attempts", attempt)
+		}
+		if wait <= 0 {
+			wait = time.Second
+		}
+		if waited+wait > maxWait {
+			return nil, nil, fmt.Errorf("rate limited for %s, longer than we'll wait", wait)
+		}
+		waited += wait
+		sleep(wait)
+	}
+}
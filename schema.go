@@ -18,18 +18,10 @@ type RegionID string
 func (ct *JSONTime) UnmarshalJSON(b []byte) error {
 	// Unmarshall "2024-01-30T16:35:00" into a time.Time
 
-	// Annoyingly this timestamp doesn't include any time zone information.
-	// We're going to have to learn the timezone based on the region?
-	// Bleh, then I need to track start/end of DST for each region.
-	// This sucks.
-
-	// For now assume everything's in Brisbane time, I.E. UTC+10
-	brisbaneLocation, err := time.LoadLocation("Australia/Brisbane")
-	if err != nil {
-		return err
-	}
-
-	date, err := time.ParseInLocation("\"2006-01-02T15:04:05\"", string(b), brisbaneLocation)
+	// This timestamp doesn't include any time zone information, but it's always
+	// NEM time. Converting to each region's local time is left to whoever
+	// displays it.
+	date, err := time.ParseInLocation("\"2006-01-02T15:04:05\"", string(b), NEMTime)
 	if err != nil {
 		return err
 	}
@@ -49,6 +41,28 @@ type Interval struct {
 	SemiScheduledGeneration float64  `json:"SEMISCHEDULEDGENERATION"`
 }
 
+// IntervalJSON is how we present an Interval to the outside world, as opposed to
+// the way AEMO presents it to us.
+type IntervalJSON struct {
+	Time                    time.Time `json:"time"`
+	RRP                     float64   `json:"rrp"`
+	TotalDemand             float64   `json:"total_demand"`
+	NetInterchange          float64   `json:"net_interchange"`
+	ScheduledGeneration     float64   `json:"scheduled_generation"`
+	SemiScheduledGeneration float64   `json:"semischeduled_generation"`
+}
+
+func NewIntervalJSON(i Interval) IntervalJSON {
+	return IntervalJSON{
+		Time:                    i.SettlementDate.Time,
+		RRP:                     i.RRP,
+		TotalDemand:             i.TotalDemand,
+		NetInterchange:          i.NetInterchange,
+		ScheduledGeneration:     i.ScheduledGeneration,
+		SemiScheduledGeneration: i.SemiScheduledGeneration,
+	}
+}
+
 func (i *Interval) Validate() error {
 	// Validate the Interval struct
 
@@ -79,6 +93,83 @@ type GridBotCfg struct {
 	MastodonClientSecret string   `json:"MastodonClientSecret"`
 	MastodonUserEmail    string   `json:"MastodonUserEmail"`
 	MastodonUserPassword string   `json:"MastodonUserPassword"`
-	TestMode             bool
-	MastodonURL          string
+	// Optional fields.
+	Visibility          string       `json:"Visibility"`     // Defaults to "public".
+	PeakEnterRRP        float64      `json:"PeakEnterRRP"`   // Defaults to INTERESTING_PEAK_RRP.
+	PeakExitRRP         float64      `json:"PeakExitRRP"`    // Defaults to PeakEnterRRP.
+	PeakDeltaRRP        float64      `json:"PeakDeltaRRP"`   // Defaults to UNINTERESTING_DELTA_RRP. Applies to troughs too.
+	TroughsEnabled      bool         `json:"TroughsEnabled"` // Toots about troughs as well as peaks.
+	TroughRRP           float64      `json:"TroughRRP"`      // Forecast prices below this are a trough. Defaults to 0.
+	DowngradeMode       string       `json:"DowngradeMode"`  // DOWNGRADE_MODE_REPLY or DOWNGRADE_MODE_EDIT. Defaults to reply.
+	PlotDemand          bool         `json:"PlotDemand"`     // Adds a panel of demand and generation under the price plot.
+	PlotTheme           string       `json:"PlotTheme"`      // PLOT_THEME_LIGHT or PLOT_THEME_DARK. Defaults to light.
+	BlueskyHandle       string       `json:"BlueskyHandle"`
+	BlueskyAppPassword  string       `json:"BlueskyAppPassword"`
+	BlueskyPDSURL       string       `json:"BlueskyPDSURL"` // Defaults to https://bsky.social
+	MatrixHomeserverURL string       `json:"MatrixHomeserverURL"`
+	MatrixAccessToken   string       `json:"MatrixAccessToken"`
+	MatrixRoomID        string       `json:"MatrixRoomID"`
+	TelegramBotToken    string       `json:"TelegramBotToken"`
+	TelegramChatID      string       `json:"TelegramChatID"`
+	DiscordWebhookURL   string       `json:"DiscordWebhookURL"`
+	Webhooks            []WebhookCfg `json:"Webhooks"`
+	TestMode            bool
+	MastodonURL         string
+	StateStore          StateStore     `json:"-"`
+	Templates           *TootTemplates `json:"-"` // Defaults to the built-in ones.
+}
+
+// Fills in the defaults for any optional fields that aren't set.
+func (c GridBotCfg) withDefaults() GridBotCfg {
+	if c.Visibility == "" {
+		c.Visibility = "public"
+	}
+	if c.PeakEnterRRP == 0 {
+		c.PeakEnterRRP = INTERESTING_PEAK_RRP
+	}
+	if c.PeakExitRRP == 0 {
+		c.PeakExitRRP = c.PeakEnterRRP
+	}
+	if c.PeakDeltaRRP == 0 {
+		c.PeakDeltaRRP = UNINTERESTING_DELTA_RRP
+	}
+	if c.DowngradeMode == "" {
+		c.DowngradeMode = DOWNGRADE_MODE_REPLY
+	}
+	if c.Templates == nil {
+		c.Templates = defaultTootTemplates
+	}
+	return c
+}
+
+func (c GridBotCfg) Validate() error {
+	c = c.withDefaults()
+	if c.PeakEnterRRP < 0 {
+		return fmt.Errorf("PeakEnterRRP must be positive")
+	}
+	if c.PeakExitRRP < 0 {
+		return fmt.Errorf("PeakExitRRP must be positive")
+	}
+	// Otherwise a peak could be cancelled as soon as it was announced.
+	if c.PeakExitRRP > c.PeakEnterRRP {
+		return fmt.Errorf("PeakExitRRP (%.2f) must not be above PeakEnterRRP (%.2f)", c.PeakExitRRP, c.PeakEnterRRP)
+	}
+	if c.PeakDeltaRRP < 0 {
+		return fmt.Errorf("PeakDeltaRRP must be positive")
+	}
+	if c.TroughsEnabled && c.TroughRRP >= c.PeakExitRRP {
+		return fmt.Errorf("TroughRRP (%.2f) must be below PeakExitRRP (%.2f)", c.TroughRRP, c.PeakExitRRP)
+	}
+	if c.DowngradeMode != DOWNGRADE_MODE_REPLY && c.DowngradeMode != DOWNGRADE_MODE_EDIT {
+		return fmt.Errorf("unknown DowngradeMode: %s", c.DowngradeMode)
+	}
+	if err := (PlotOptions{Theme: c.PlotTheme}).Validate(); err != nil {
+		return err
+	}
+	return nil
+}
+
+type WebhookCfg struct {
+	URL    string `json:"URL"`
+	Secret string `json:"Secret"` // Used to sign the payloads. Optional, but a good idea.
 }
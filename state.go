@@ -0,0 +1,181 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// GridBotState is the part of a GridBot that needs to survive a restart so
+// that we don't toot about the same peak twice.
+type GridBotState struct {
+	LastTootedPeakRRP       float64      `json:"LastTootedPeakRRP"`
+	LastTootedPeakTime      time.Time    `json:"LastTootedPeakTime"`
+	LastTootedPeakStatusIDs StatusIDs    `json:"LastTootedPeakStatusIDs,omitempty"`
+	LastTootedPeaks         []TootedPeak `json:"LastTootedPeaks"`
+	PendingOutcomes         []TootedPeak `json:"PendingOutcomes,omitempty"`
+	LastTootedTrough        PriceWindow  `json:"LastTootedTrough"`
+	LastToot                string       `json:"LastToot"`
+}
+
+// StateStore persists GridBotState between runs. One store is shared by all the
+// GridBots, so implementations must be safe to use from multiple goroutines.
+type StateStore interface {
+	// Load returns the saved state for a region, or ErrNoState if there isn't any.
+	Load(regionID RegionID) (GridBotState, error)
+	Save(regionID RegionID, state GridBotState) error
+}
+
+var ErrNoState = errors.New("no saved state")
+
+// NewStateStore builds a StateStore of the given kind. An empty kind means state
+// isn't persisted at all, in which case the returned store is nil. If path is
+// empty a default under data/ is used.
+func NewStateStore(kind, path string) (StateStore, error) {
+	switch kind {
+	case "", "none":
+		return nil, nil
+	case "json":
+		if path == "" {
+			path = "data/state.json"
+		}
+		return NewJSONStateStore(path), nil
+	case "sqlite":
+		if path == "" {
+			path = "data/state.db"
+		}
+		return NewSQLiteStateStore(path)
+	default:
+		return nil, fmt.Errorf("unknown state store: %s", kind)
+	}
+}
+
+// JSONStateStore keeps the state of every region in a single JSON file.
+type JSONStateStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewJSONStateStore(path string) *JSONStateStore {
+	return &JSONStateStore{path: path}
+}
+
+func (s *JSONStateStore) read() (map[RegionID]GridBotState, error) {
+	states := make(map[RegionID]GridBotState)
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return states, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &states); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %s", s.path, err)
+	}
+	return states, nil
+}
+
+func (s *JSONStateStore) Load(regionID RegionID) (GridBotState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states, err := s.read()
+	if err != nil {
+		return GridBotState{}, err
+	}
+	if state, ok := states[regionID]; ok {
+		return state, nil
+	}
+	return GridBotState{}, ErrNoState
+}
+
+func (s *JSONStateStore) Save(regionID RegionID, state GridBotState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states, err := s.read()
+	if err != nil {
+		return err
+	}
+	states[regionID] = state
+
+	b, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	// Write to a temporary file and rename it over the top so a crash mid-write
+	// doesn't leave us with a truncated state file.
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+const SQLITE_STATE_SCHEMA = `CREATE TABLE IF NOT EXISTS gridbot_state (
+	region_id  TEXT PRIMARY KEY,
+	state      TEXT NOT NULL,
+	updated_at TEXT NOT NULL
+)`
+
+// SQLiteStateStore keeps the state of each region as a row in a SQLite database.
+type SQLiteStateStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteStateStore(path string) (*SQLiteStateStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite only allows one writer at a time, and the GridBots all save from
+	// their own goroutines.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(SQLITE_STATE_SCHEMA); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create state table: %s", err)
+	}
+	return &SQLiteStateStore{db: db}, nil
+}
+
+func (s *SQLiteStateStore) Load(regionID RegionID) (GridBotState, error) {
+	var state GridBotState
+	var b string
+	err := s.db.QueryRow("SELECT state FROM gridbot_state WHERE region_id = ?", string(regionID)).Scan(&b)
+	if errors.Is(err, sql.ErrNoRows) {
+		return state, ErrNoState
+	} else if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal([]byte(b), &state); err != nil {
+		return state, fmt.Errorf("failed to parse state for %s: %s", regionID, err)
+	}
+	return state, nil
+}
+
+func (s *SQLiteStateStore) Save(regionID RegionID, state GridBotState) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO gridbot_state (region_id, state, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(region_id) DO UPDATE SET state = excluded.state, updated_at = excluded.updated_at`,
+		string(regionID), string(b), time.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+func (s *SQLiteStateStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testStateStore(store StateStore, t *testing.T) {
+	if _, err := store.Load("QLD1"); !errors.Is(err, ErrNoState) {
+		t.Fatalf("Expected ErrNoState, got %v", err)
+	}
+
+	qld := GridBotState{
+		LastTootedPeakRRP:       1234.5,
+		LastTootedPeakTime:      time.Date(2024, 1, 30, 17, 30, 0, 0, time.UTC),
+		LastTootedPeakStatusIDs: StatusIDs{"mastodon": "1234"},
+		LastToot:                "qld toot",
+	}
+	nsw := GridBotState{
+		LastTootedPeakRRP:  678.9,
+		LastTootedPeakTime: time.Date(2024, 1, 30, 18, 0, 0, 0, time.UTC),
+		LastTootedTrough: PriceWindow{
+			Start:   time.Date(2024, 1, 31, 11, 0, 0, 0, time.UTC),
+			End:     time.Date(2024, 1, 31, 13, 30, 0, 0, time.UTC),
+			RRP:     -42.5,
+			RRPTime: time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC),
+		},
+		LastToot: "nsw toot",
+	}
+	if err := store.Save("QLD1", qld); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save("NSW1", nsw); err != nil {
+		t.Fatal(err)
+	}
+
+	// Overwrite the first region to make sure saves replace rather than append.
+	qld.LastTootedPeakRRP = 2000
+	if err := store.Save("QLD1", qld); err != nil {
+		t.Fatal(err)
+	}
+
+	for regionID, want := range map[RegionID]GridBotState{"QLD1": qld, "NSW1": nsw} {
+		got, err := store.Load(regionID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !FloatEquals(want.LastTootedPeakRRP, got.LastTootedPeakRRP) {
+			t.Errorf("Expected %f, got %f", want.LastTootedPeakRRP, got.LastTootedPeakRRP)
+		}
+		if !want.LastTootedPeakTime.Equal(got.LastTootedPeakTime) {
+			t.Errorf("Expected %s, got %s", want.LastTootedPeakTime, got.LastTootedPeakTime)
+		}
+		if !want.LastTootedTrough.End.Equal(got.LastTootedTrough.End) || !FloatEquals(want.LastTootedTrough.RRP, got.LastTootedTrough.RRP) {
+			t.Errorf("Expected %+v, got %+v", want.LastTootedTrough, got.LastTootedTrough)
+		}
+		if want.LastTootedPeakStatusIDs["mastodon"] != got.LastTootedPeakStatusIDs["mastodon"] {
+			t.Errorf("Expected %v, got %v", want.LastTootedPeakStatusIDs, got.LastTootedPeakStatusIDs)
+		}
+		if want.LastToot != got.LastToot {
+			t.Errorf("Expected %s, got %s", want.LastToot, got.LastToot)
+		}
+	}
+}
+
+func TestJSONStateStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	testStateStore(NewJSONStateStore(path), t)
+
+	// A fresh store pointed at the same file should see the saved state.
+	if state, err := NewJSONStateStore(path).Load("NSW1"); err != nil {
+		t.Fatal(err)
+	} else if want, got := "nsw toot", state.LastToot; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestSQLiteStateStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	store, err := NewSQLiteStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStateStore(store, t)
+	store.Close()
+
+	if store, err = NewSQLiteStateStore(path); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if state, err := store.Load("NSW1"); err != nil {
+		t.Fatal(err)
+	} else if want, got := "nsw toot", state.LastToot; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestUnknownStateStore(t *testing.T) {
+	if _, err := NewStateStore("redis", ""); err == nil {
+		t.Errorf("Expected error, got nil")
+	}
+	if store, err := NewStateStore("", ""); err != nil || store != nil {
+		t.Errorf("Expected no store, got %v, %v", store, err)
+	}
+}
+
+func TestGridBotRestoresState(t *testing.T) {
+	store := NewJSONStateStore(filepath.Join(t.TempDir(), "state.json"))
+
+	cfg := GridBotCfg{}
+	cfg.TestMode = true
+	cfg.RegionID = "QLD1"
+	cfg.StateStore = store
+
+	var gridBot *GridBot
+	var err error
+	if gridBot, err = NewGridBot(cfg); err != nil {
+		t.Fatal(err)
+	}
+	notifier := newFakeNotifier()
+	gridBot.notifiers = []Notifier{notifier}
+
+	peakTime := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+	peakRRP := float64(INTERESTING_PEAK_RRP * 3)
+	gridBot.processInterval(NewForecastInterval(gridBot, peakRRP, peakTime, t))
+	gridBot.considerPostingToot()
+	notifier.waitForPost(t)
+	expectedToot := FormatExpectedToot(peakRRP, peakTime, "Queensland", 0, PEAK, OneIntervalWindow(peakRRP, peakTime))
+	ValidateToot(gridBot, peakRRP, peakTime, expectedToot, t)
+
+	// Simulate a restart with a new GridBot using the same store.
+	if gridBot, err = NewGridBot(cfg); err != nil {
+		t.Fatal(err)
+	}
+	notifier = newFakeNotifier()
+	gridBot.notifiers = []Notifier{notifier}
+	ValidateToot(gridBot, peakRRP, peakTime, expectedToot, t)
+
+	// The same peak after the restart shouldn't be tooted again.
+	gridBot.processInterval(NewForecastInterval(gridBot, peakRRP, peakTime, t))
+	gridBot.considerPostingToot()
+	select {
+	case p := <-notifier.posts:
+		t.Errorf("Expected no toot, got %s", p.status)
+	default:
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"time"
+)
+
+const TELEGRAM_DEFAULT_API = "https://api.telegram.org"
+
+// Telegram posts to a chat as a Telegram bot.
+type Telegram struct {
+	apiURL   string
+	botToken string
+	chatID   string
+	client   *http.Client
+	sleep    func(time.Duration)
+}
+
+func NewTelegram(apiURL, botToken, chatID string) *Telegram {
+	if apiURL == "" {
+		apiURL = TELEGRAM_DEFAULT_API
+	}
+	return &Telegram{
+		apiURL:   apiURL,
+		botToken: botToken,
+		chatID:   chatID,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		sleep:    time.Sleep,
+	}
+}
+
+func (t *Telegram) Name() string {
+	return "telegram"
+}
+
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+// When Telegram rate limits us it says how long to wait in the response body.
+func telegramRetryAfter(resp *http.Response, body []byte) time.Duration {
+	var r telegramResponse
+	if err := json.Unmarshal(body, &r); err == nil && r.Parameters.RetryAfter > 0 {
+		return time.Duration(r.Parameters.RetryAfter) * time.Second
+	}
+	return retryAfterHeader(resp)
+}
+
+// Calls a bot API method. newBody returns the body and its content type, and is
+// called again if we have to retry.
+func (t *Telegram) call(method string, newBody func() (io.Reader, string, error)) error {
+	newReq := func() (*http.Request, error) {
+		body, contentType, err := newBody()
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequest("POST", fmt.Sprintf("%s/bot%s/%s", t.apiURL, t.botToken, method), body)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", contentType)
+		return req, nil
+	}
+	resp, body, err := doHonouringRetryAfter(t.client, newReq, telegramRetryAfter, t.sleep, RATE_LIMIT_MAX_WAIT)
+	if err != nil {
+		return fmt.Errorf("%s failed: %s", method, err)
+	}
+	var r telegramResponse
+	json.Unmarshal(body, &r)
+	if resp.StatusCode != http.StatusOK || !r.OK {
+		return fmt.Errorf("%s got status code %d: %s", method, resp.StatusCode, r.Description)
+	}
+	return nil
+}
+
+func (t *Telegram) PostStatus(status string) error {
+	return t.call("sendMessage", func() (io.Reader, string, error) {
+		b, err := json.Marshal(map[string]string{
+			"chat_id": t.chatID,
+			"text":    status,
+		})
+		return bytes.NewReader(b), "application/json", err
+	})
+}
+
+// Sends the image with the status as its caption.
+func (t *Telegram) PostStatusWithImageFromReader(status string, file io.Reader, altText string, visibility string) (string, error) {
+	image, err := io.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
+	return "", t.call("sendPhoto", func() (io.Reader, string, error) {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		mw.WriteField("chat_id", t.chatID)
+		mw.WriteField("caption", status)
+		fw, err := mw.CreateFormFile("photo", "forecast.png")
+		if err != nil {
+			return nil, "", err
+		}
+		fw.Write(image)
+		if err := mw.Close(); err != nil {
+			return nil, "", err
+		}
+		return &buf, mw.FormDataContentType(), nil
+	})
+}
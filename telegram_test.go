@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTelegramSendPhoto(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if want, got := "/botbot-token/sendPhoto", r.URL.Path; want != got {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+		if requests == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 7","parameters":{"retry_after":7}}`))
+			return
+		}
+		if want, got := "-100123", r.FormValue("chat_id"); want != got {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+		if want, got := "A peak!", r.FormValue("caption"); want != got {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+		f, _, err := r.FormFile("photo")
+		if err != nil {
+			t.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if b, _ := io.ReadAll(f); !bytes.Equal([]byte("png"), b) {
+			t.Errorf("Expected png, got %s", b)
+		}
+		w.Write([]byte(`{"ok":true,"result":{"message_id":1}}`))
+	}))
+	defer server.Close()
+
+	var slept []time.Duration
+	tg := NewTelegram(server.URL, "bot-token", "-100123")
+	tg.sleep = func(d time.Duration) { slept = append(slept, d) }
+
+	if _, err := tg.PostStatusWithImageFromReader("A peak!", bytes.NewReader([]byte("png")), "A plot", "public"); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 2, requests; want != got {
+		t.Errorf("Expected %d requests, got %d", want, got)
+	}
+	if want, got := []time.Duration{7 * time.Second}, slept; len(got) != 1 || want[0] != got[0] {
+		t.Errorf("Expected to wait %v, waited %v", want, got)
+	}
+}
+
+func TestTelegramSendMessage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if want, got := "/botbot-token/sendMessage", r.URL.Path; want != got {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		if want, got := "Hello", req["text"]; want != got {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`))
+	}))
+	defer server.Close()
+
+	tg := NewTelegram(server.URL, "bot-token", "-100123")
+	if err := tg.PostStatus("Hello"); err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+}
+
+func TestTelegramGivesUpWhenRateLimited(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	tg := NewTelegram(server.URL, "bot-token", "-100123")
+	tg.sleep = func(time.Duration) {}
+	if err := tg.PostStatus("Hello"); err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	if want, got := RATE_LIMIT_ATTEMPTS, requests; want != got {
+		t.Errorf("Expected %d requests, got %d", want, got)
+	}
+}
+
+func TestTelegramGivesUpOnLongRateLimits(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "20")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	tg := NewTelegram(server.URL, "bot-token", "-100123")
+	waited := time.Duration(0)
+	tg.sleep = func(d time.Duration) { waited += d }
+	if err := tg.PostStatus("Hello"); err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	// The first wait fits in RATE_LIMIT_MAX_WAIT, but a second one wouldn't.
+	if want, got := 2, requests; want != got {
+		t.Errorf("Expected %d requests, got %d", want, got)
+	}
+	if want, got := 20*time.Second, waited; want != got {
+		t.Errorf("Expected to wait %s, got %s", want, got)
+	}
+}
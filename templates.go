@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// The units prices can be shown in. AEMO's are $/MWh.
+const (
+	UNITS_DOLLARS_PER_MWH = "$/MWh"
+	UNITS_CENTS_PER_KWH   = "c/kWh"
+	UNITS_DOLLARS_PER_KWH = "$/kWh"
+)
+
+// The built-in toot templates. With prices in $/kWh these say the same as
+// PEAK_TOOT_FORMAT and friends, which are what we recognise our old toots by.
+const DEFAULT_PEAK_TEMPLATE = "A new {{.Region}} wholesale electricity price peak of {{.PeakRRP}} is predicted at {{.PeakTime}}, with prices averaging {{.AverageRRP}} from {{.Window.Start}} to {{.Window.End}}: {{.URL}}"
+const DEFAULT_PEAK_DOWNGRADE_TEMPLATE = "The {{.Region}} predicted wholesale electricity price peak of {{.OldPeakRRP}} has been downgraded to a peak of {{.PeakRRP}} at {{.PeakTime}}, with prices averaging {{.AverageRRP}} from {{.Window.Start}} to {{.Window.End}}: {{.URL}}"
+const DEFAULT_PEAK_CANCELLED_TEMPLATE = "The {{.Region}} wholesale electricity price peak of {{.OldPeakRRP}} at {{.PeakTime}} has been averted. Thanks AEMO! {{.URL}}"
+
+// Price is an RRP in $/MWh that prints itself in the chosen units.
+type Price struct {
+	RRP   float64
+	Units string
+}
+
+func (p Price) String() string {
+	// Negative prices read as "-$0.05/kWh", with the sign before the dollar sign.
+	sign, value := "", p.Value()
+	if value < 0 {
+		sign, value = "-", -value
+	}
+	switch p.Units {
+	case UNITS_DOLLARS_PER_MWH:
+		return fmt.Sprintf("%s$%.2f/MWh", sign, value)
+	case UNITS_CENTS_PER_KWH:
+		return fmt.Sprintf("%s%.2fc/kWh", sign, value)
+	default:
+		return fmt.Sprintf("%s$%.2f/kWh", sign, value)
+	}
+}
+
+// Returns the price as a number in its units.
+func (p Price) Value() float64 {
+	switch p.Units {
+	case UNITS_DOLLARS_PER_MWH:
+		return p.RRP
+	case UNITS_CENTS_PER_KWH:
+		return p.RRP / 10
+	default:
+		return p.RRP / 1000
+	}
+}
+
+// Returns true if units are ones prices can be shown in.
+func validUnits(units string) bool {
+	switch units {
+	case UNITS_DOLLARS_PER_MWH, UNITS_CENTS_PER_KWH, UNITS_DOLLARS_PER_KWH:
+		return true
+	}
+	return false
+}
+
+// TootWindow is a PriceWindow's times of day, in the region's local time.
+type TootWindow struct {
+	Start string
+	End   string
+}
+
+// TootData is what the toot templates are filled in with.
+type TootData struct {
+	Region     string
+	PeakRRP    Price // The new peak. For a cancellation, the highest price still forecast over it.
+	OldPeakRRP Price // The peak we last tooted about, if there was one.
+	AverageRRP Price // The average price over the window.
+	// The time of day of the peak, and its window, in the region's local time.
+	// For a cancellation these are the cancelled peak's.
+	PeakTime string
+	Window   TootWindow
+	URL      string
+}
+
+// TootTemplatesCfg is the file operators can customise the peak toots with. Any
+// template left blank is the built-in one, and each region can override any of
+// the settings.
+type TootTemplatesCfg struct {
+	Units     string                        `json:"Units"` // Defaults to UNITS_DOLLARS_PER_KWH.
+	Peak      string                        `json:"Peak"`
+	Downgrade string                        `json:"Downgrade"`
+	Cancelled string                        `json:"Cancelled"`
+	Regions   map[RegionID]TootTemplatesCfg `json:"Regions"`
+}
+
+// TootTemplates are the parsed templates a GridBot toots about peaks with.
+type TootTemplates struct {
+	Units     string
+	Peak      *template.Template
+	Downgrade *template.Template
+	Cancelled *template.Template
+}
+
+// Reads a TootTemplatesCfg from a JSON file.
+func LoadTootTemplatesCfg(path string) (TootTemplatesCfg, error) {
+	var cfg TootTemplatesCfg
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse %s: %s", path, err)
+	}
+	return cfg, nil
+}
+
+var defaultTootTemplates = DefaultTootTemplates()
+
+func DefaultTootTemplates() *TootTemplates {
+	return &TootTemplates{
+		Units:     UNITS_DOLLARS_PER_KWH,
+		Peak:      template.Must(parseTootTemplate("peak", DEFAULT_PEAK_TEMPLATE)),
+		Downgrade: template.Must(parseTootTemplate("downgrade", DEFAULT_PEAK_DOWNGRADE_TEMPLATE)),
+		Cancelled: template.Must(parseTootTemplate("cancelled", DEFAULT_PEAK_CANCELLED_TEMPLATE)),
+	}
+}
+
+// Parses a toot template and makes sure it can be filled in.
+func parseTootTemplate(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	sample := TootData{
+		Region:     "Queensland",
+		PeakRRP:    Price{RRP: 1500},
+		OldPeakRRP: Price{RRP: 900},
+		AverageRRP: Price{RRP: 1200},
+		PeakTime:   "17:30",
+		Window:     TootWindow{Start: "17:00", End: "18:30"},
+		URL:        AEMO_VISUALISATION_URL,
+	}
+	if err := t.Execute(new(strings.Builder), sample); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Returns the templates for a region, with its overrides applied. Any setting
+// that's invalid is reported in err, and the built-in one is used in its place.
+func (c TootTemplatesCfg) ForRegion(regionID RegionID) (*TootTemplates, error) {
+	region := c.Regions[regionID]
+	pick := func(override, fallback string) string {
+		if override != "" {
+			return override
+		}
+		return fallback
+	}
+
+	templates := DefaultTootTemplates()
+	var errs []string
+	if units := pick(region.Units, c.Units); validUnits(units) {
+		templates.Units = units
+	} else if units != "" {
+		errs = append(errs, fmt.Sprintf("unknown units: %s", units))
+	}
+	for _, t := range []struct {
+		name     string
+		text     string
+		template **template.Template
+	}{
+		{"peak", pick(region.Peak, c.Peak), &templates.Peak},
+		{"downgrade", pick(region.Downgrade, c.Downgrade), &templates.Downgrade},
+		{"cancelled", pick(region.Cancelled, c.Cancelled), &templates.Cancelled},
+	} {
+		if t.text == "" {
+			continue
+		}
+		if parsed, err := parseTootTemplate(t.name, t.text); err != nil {
+			errs = append(errs, fmt.Sprintf("invalid %s template: %s", t.name, err))
+		} else {
+			*t.template = parsed
+		}
+	}
+	if len(errs) > 0 {
+		return templates, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return templates, nil
+}
+
+// Fills in a toot template about the peak in w, or the built-in fallback if that
+// fails. The prices are in $/MWh.
+func (gb *GridBot) formatPeakToot(t, fallback *template.Template, w PriceWindow, oldPeakRRP float64) string {
+	units := gb.cfg.Templates.Units
+	data := TootData{
+		Region:     gb.regionString,
+		PeakRRP:    Price{RRP: w.RRP, Units: units},
+		OldPeakRRP: Price{RRP: oldPeakRRP, Units: units},
+		AverageRRP: Price{RRP: w.AverageRRP, Units: units},
+		PeakTime:   gb.clock(w.RRPTime),
+		Window:     TootWindow{Start: gb.clock(w.Start), End: gb.clock(w.End)},
+		URL:        AEMO_VISUALISATION_URL,
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		// The templates are checked when they're loaded, so this shouldn't happen.
+		slog.Error("Failed to fill in toot template", "region", gb.regionString, "template", t.Name(), "err", err)
+		b.Reset()
+		fallback.Execute(&b, data)
+	}
+	return b.String()
+}
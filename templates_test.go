@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPriceUnits(t *testing.T) {
+	for _, tt := range []struct {
+		units string
+		want  string
+	}{
+		{UNITS_DOLLARS_PER_KWH, "$1.23/kWh"},
+		{UNITS_CENTS_PER_KWH, "123.46c/kWh"},
+		{UNITS_DOLLARS_PER_MWH, "$1234.56/MWh"},
+		{"", "$1.23/kWh"},
+	} {
+		if want, got := tt.want, (Price{RRP: 1234.56, Units: tt.units}).String(); want != got {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+	}
+}
+
+func TestNegativePriceUnits(t *testing.T) {
+	for _, tt := range []struct {
+		units string
+		want  string
+	}{
+		{UNITS_DOLLARS_PER_KWH, "-$0.05/kWh"},
+		{UNITS_CENTS_PER_KWH, "-5.00c/kWh"},
+		{UNITS_DOLLARS_PER_MWH, "-$50.00/MWh"},
+	} {
+		if want, got := tt.want, (Price{RRP: -50, Units: tt.units}).String(); want != got {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+	}
+}
+
+// The built-in templates have to keep saying the same thing as the format
+// strings, or we won't recognise our own toots on the timeline.
+func TestDefaultTootTemplatesMatchFormats(t *testing.T) {
+	gridBot, err := NewGridBot(GridBotCfg{RegionID: "QLD1", TestMode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 1, 30, 17, 0, 0, 0, NEMTime)
+	w := PriceWindow{Start: start, End: start.Add(90 * time.Minute), RRP: 1500, RRPTime: start.Add(30 * time.Minute), AverageRRP: 1200}
+	d := defaultTootTemplates
+
+	if want, got := fmt.Sprintf(PEAK_TOOT_FORMAT, "Queensland", 1.5, "17:30", 1.2, "17:00", "18:30"), gridBot.formatPeakToot(d.Peak, d.Peak, w, 0); want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if want, got := fmt.Sprintf(PEAK_DOWNGRADE_TOOT_FORMAT, "Queensland", 2.0, 1.5, "17:30", 1.2, "17:00", "18:30"), gridBot.formatPeakToot(d.Downgrade, d.Downgrade, w, 2000); want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if want, got := fmt.Sprintf(PEAK_CANCELLED_TOOT_FORMAT, "Queensland", 2.0, "17:30"), gridBot.formatPeakToot(d.Cancelled, d.Cancelled, w, 2000); want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestTootTemplatesForRegion(t *testing.T) {
+	cfg := TootTemplatesCfg{
+		Units: UNITS_CENTS_PER_KWH,
+		Peak:  "{{.Region}} peak: {{.PeakRRP}} at {{.PeakTime}}",
+		Regions: map[RegionID]TootTemplatesCfg{
+			"SA1":  {Units: UNITS_DOLLARS_PER_MWH, Cancelled: "No more {{.Region}} peak"},
+			"NSW1": {Peak: "{{.Nope}}", Units: "bananas"},
+		},
+	}
+
+	qld, err := cfg.ForRegion("QLD1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := UNITS_CENTS_PER_KWH, qld.Units; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if want, got := cfg.Peak, qld.Peak.Root.String(); want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if want, got := DEFAULT_PEAK_CANCELLED_TEMPLATE, qld.Cancelled.Root.String(); want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	sa, err := cfg.ForRegion("SA1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := UNITS_DOLLARS_PER_MWH, sa.Units; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if want, got := cfg.Peak, sa.Peak.Root.String(); want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if want, got := "No more {{.Region}} peak", sa.Cancelled.Root.String(); want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	// Bad settings are reported, and the built-in ones used instead.
+	nsw, err := cfg.ForRegion("NSW1")
+	if err == nil {
+		t.Error("Expected an error for an invalid template")
+	}
+	if want, got := DEFAULT_PEAK_TEMPLATE, nsw.Peak.Root.String(); want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if want, got := UNITS_DOLLARS_PER_KWH, nsw.Units; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	if _, err := (TootTemplatesCfg{Downgrade: "{{.Region"}).ForRegion("QLD1"); err == nil {
+		t.Error("Expected an error for a template that doesn't parse")
+	}
+}
+
+func TestBuildGridBotsWithTootTemplates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "templates.json")
+	templates := `{"Units": "c/kWh", "Regions": {"SA1": {"Peak": "{{.Region}} peak of {{.PeakRRP}} at {{.PeakTime}}"}}}`
+	if err := os.WriteFile(path, []byte(templates), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config{TestMode: true, TootTemplatesPath: path}
+	cfg.GridBotCredentials = `[{"RegionID": "SA1"}, {"RegionID": "TAS1"}]`
+	gridBots, err := BuildGridBots(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().Add(time.Hour).Truncate(FORECAST_INTERVAL_LENGTH)
+	sa := gridBots["SA1"]
+	sa.forecasts = NewForecastRun("SA1", start, 100, 1500, 100)
+	sa.forecastsStale = false
+	sa.considerPostingToot()
+	if want, got := fmt.Sprintf("South Australia peak of 150.00c/kWh at %s", sa.clock(start.Add(time.Hour))), sa.lastToot; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	tas := gridBots["TAS1"]
+	tas.forecasts = NewForecastRun("TAS1", start, 100, 100, 100)
+	tas.forecastsStale = false
+	tas.tootedPeaks = []TootedPeak{{PriceWindow: OneIntervalWindow(1500, start.Add(time.Hour))}}
+	tas.considerPostingToot()
+	if want, got := fmt.Sprintf("The Tasmania wholesale electricity price peak of 150.00c/kWh at %s has been averted. Thanks AEMO! %s", tas.clock(start.Add(time.Hour)), AEMO_VISUALISATION_URL), tas.lastToot; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
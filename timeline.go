@@ -0,0 +1,134 @@
+package main
+
+import (
+	"html"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-mastodon"
+)
+
+// How many of our own statuses to look through for the last peak toot on startup.
+const RECOVERY_STATUS_COUNT = 20
+
+var peakTootRegexp = tootFormatRegexp(PEAK_TOOT_FORMAT)
+var peakDowngradeTootRegexp = tootFormatRegexp(PEAK_DOWNGRADE_TOOT_FORMAT)
+var peakCancelledTootRegexp = tootFormatRegexp(PEAK_CANCELLED_TOOT_FORMAT)
+var peakRevisedNoteRegexp = regexp.MustCompile(strings.ReplaceAll(regexp.QuoteMeta(PEAK_REVISED_NOTE_FORMAT), `%s`, `[0-9]{2}:[0-9]{2}`) + "$")
+
+var htmlTagRegexp = regexp.MustCompile(`<[^>]*>`)
+
+// Turns one of the toot format strings into a regexp that captures each of its
+// verbs. Mastodon mangles links when it renders them, so the link isn't matched
+// exactly.
+func tootFormatRegexp(format string) *regexp.Regexp {
+	r := regexp.QuoteMeta(format)
+	r = strings.ReplaceAll(r, regexp.QuoteMeta(AEMO_VISUALISATION_URL), `\S*`)
+	r = strings.ReplaceAll(r, `%s`, `(.+?)`)
+	r = strings.ReplaceAll(r, `%\.2f`, `(-?[0-9]+\.[0-9]+)`)
+	return regexp.MustCompile("^" + r + "$")
+}
+
+// Converts the HTML content of a status back into the plain text we tooted.
+func statusText(content string) string {
+	content = strings.ReplaceAll(content, "<br>", "\n")
+	content = strings.ReplaceAll(content, "</p><p>", "\n\n")
+	return strings.TrimSpace(html.UnescapeString(htmlTagRegexp.ReplaceAllString(content, "")))
+}
+
+// Works out the peak time from the "15:04" in a toot, which is in the region's
+// local time. The toot only has the time of day, so this assumes the peak is the
+// first one at or after the toot was posted, which holds because we only look
+// eight hours ahead.
+func peakTimeFromToot(clock string, postedAt time.Time, location *time.Location) (time.Time, bool) {
+	c, err := time.Parse("15:04", clock)
+	if err != nil {
+		return time.Time{}, false
+	}
+	postedAt = postedAt.In(location)
+	peakTime := time.Date(postedAt.Year(), postedAt.Month(), postedAt.Day(), c.Hour(), c.Minute(), 0, 0, location)
+	if peakTime.Before(postedAt.Truncate(time.Minute)) {
+		peakTime = peakTime.AddDate(0, 0, 1)
+	}
+	return peakTime, true
+}
+
+// Parses a toot we've previously posted and returns the lastTootedPeakRRP and
+// lastTootedPeakTime it would have left us with. ok is false if the toot isn't
+// a peak toot for this region.
+func parsePeakToot(toot string, postedAt time.Time, regionString string, location *time.Location) (rrp float64, peakTime time.Time, ok bool) {
+	var region, price, clock string
+	// A peak toot that's been edited with a downgrade says what it's been revised to.
+	toot = peakRevisedNoteRegexp.ReplaceAllString(toot, "")
+	if m := peakTootRegexp.FindStringSubmatch(toot); m != nil {
+		region, price, clock = m[1], m[2], m[3]
+	} else if m := peakDowngradeTootRegexp.FindStringSubmatch(toot); m != nil {
+		region, price, clock = m[1], m[3], m[4]
+	} else if m := peakCancelledTootRegexp.FindStringSubmatch(toot); m != nil {
+		// After a cancellation we only know the new peak is uninteresting,
+		// so any price below the exit threshold will do.
+		region, price, clock = m[1], "0.00", m[3]
+	} else {
+		return 0, time.Time{}, false
+	}
+	if region != regionString {
+		return 0, time.Time{}, false
+	}
+	dollarsPerKWh, err := strconv.ParseFloat(price, 64)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	if peakTime, ok = peakTimeFromToot(clock, postedAt, location); !ok {
+		return 0, time.Time{}, false
+	}
+	return dollarsPerKWh * 1000, peakTime, true
+}
+
+// Restores the last tooted peak from the most recent peak toot in statuses.
+// Returns true if one was found.
+func (gb *GridBot) recoverStateFromStatuses(statuses []*mastodon.Status) bool {
+	var latest *mastodon.Status
+	var rrp float64
+	var peakTime time.Time
+	for _, s := range statuses {
+		if s.Reblog != nil {
+			continue
+		}
+		if latest != nil && !s.CreatedAt.After(latest.CreatedAt) {
+			continue
+		}
+		if r, t, ok := parsePeakToot(statusText(s.Content), s.CreatedAt, gb.regionString, gb.location); ok {
+			latest, rrp, peakTime = s, r, t
+		}
+	}
+	if latest == nil {
+		return false
+	}
+	gb.lastTootedPeakRRP = rrp
+	gb.lastTootedPeakTime = peakTime
+	gb.lastTootedPeakIDs = StatusIDs{"mastodon": string(latest.ID)}
+	gb.tootedPeaks = nil
+	gb.restoreTootedPeaks()
+	gb.lastToot = statusText(latest.Content)
+	return true
+}
+
+// Looks through our recent statuses for the last peak we tooted about, so a
+// restart without a state store doesn't repeat it.
+func (gb *GridBot) recoverStateFromTimeline() {
+	m := gb.mastodon()
+	if m == nil {
+		return
+	}
+	statuses, err := m.GetMyStatuses(RECOVERY_STATUS_COUNT)
+	if err != nil {
+		slog.Error("Failed to recover state from timeline", "region", gb.regionString, "err", err)
+		return
+	}
+	if gb.recoverStateFromStatuses(statuses) {
+		slog.Info("Recovered state from timeline", "region", gb.regionString, "lastTootedPeakRRP", gb.lastTootedPeakRRP, "lastTootedPeakTime", gb.lastTootedPeakTime)
+	}
+}
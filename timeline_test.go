@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mattn/go-mastodon"
+)
+
+// Wraps a toot up the way Mastodon renders it, link mangling and all.
+func renderToot(toot string) string {
+	link := `<a href="https://aemo.com.au/aemo/apps/visualisations/elec-nem-priceanddemand.html" target="_blank" rel="nofollow noopener noreferrer"><span class="invisible">https://</span><span class="ellipsis">aemo.com.au/aemo/apps/visualis</span><span class="invisible">ations/elec-nem-priceanddemand.html</span></a>`
+	return "<p>" + toot[:len(toot)-len(AEMO_VISUALISATION_URL)] + link + "</p>"
+}
+
+func TestParsePeakToot(t *testing.T) {
+	brisbaneLocation, err := time.LoadLocation("Australia/Brisbane")
+	if err != nil {
+		t.Fatal(err)
+	}
+	postedAt := time.Date(2024, 1, 30, 14, 10, 0, 0, brisbaneLocation)
+	lateAt := time.Date(2024, 1, 30, 22, 10, 0, 0, brisbaneLocation)
+
+	tests := []struct {
+		name     string
+		toot     string
+		postedAt time.Time
+		region   string
+		ok       bool
+		rrp      float64
+		peakTime time.Time
+	}{
+		{
+			name:     "peak",
+			toot:     fmt.Sprintf(PEAK_TOOT_FORMAT, "Queensland", 1.5, "17:30", 1.2, "17:00", "18:30"),
+			postedAt: postedAt,
+			region:   "Queensland",
+			ok:       true,
+			rrp:      1500,
+			peakTime: time.Date(2024, 1, 30, 17, 30, 0, 0, brisbaneLocation),
+		},
+		{
+			name:     "peak after midnight",
+			toot:     fmt.Sprintf(PEAK_TOOT_FORMAT, "Queensland", 0.75, "01:00", 0.75, "00:30", "01:00"),
+			postedAt: lateAt,
+			region:   "Queensland",
+			ok:       true,
+			rrp:      750,
+			peakTime: time.Date(2024, 1, 31, 1, 0, 0, 0, brisbaneLocation),
+		},
+		{
+			name:     "edited",
+			toot:     fmt.Sprintf(PEAK_TOOT_FORMAT, "Queensland", 0.8, "18:00", 0.7, "17:00", "18:30") + fmt.Sprintf(PEAK_REVISED_NOTE_FORMAT, "15:05"),
+			postedAt: postedAt,
+			region:   "Queensland",
+			ok:       true,
+			rrp:      800,
+			peakTime: time.Date(2024, 1, 30, 18, 0, 0, 0, brisbaneLocation),
+		},
+		{
+			name:     "downgrade",
+			toot:     fmt.Sprintf(PEAK_DOWNGRADE_TOOT_FORMAT, "New South Wales", 1.5, 0.9, "18:00", 0.7, "17:00", "19:00"),
+			postedAt: postedAt,
+			region:   "New South Wales",
+			ok:       true,
+			rrp:      900,
+			peakTime: time.Date(2024, 1, 30, 18, 0, 0, 0, brisbaneLocation),
+		},
+		{
+			name:     "cancelled",
+			toot:     fmt.Sprintf(PEAK_CANCELLED_TOOT_FORMAT, "Queensland", 1.5, "17:30"),
+			postedAt: postedAt,
+			region:   "Queensland",
+			ok:       true,
+			rrp:      0,
+			peakTime: time.Date(2024, 1, 30, 17, 30, 0, 0, brisbaneLocation),
+		},
+		{
+			name:     "other region",
+			toot:     fmt.Sprintf(PEAK_TOOT_FORMAT, "Tasmania", 1.5, "17:30", 1.2, "17:00", "18:30"),
+			postedAt: postedAt,
+			region:   "Queensland",
+			ok:       false,
+		},
+		{
+			name:     "intro toot",
+			toot:     fmt.Sprintf(INTRO_TOOT, "Queensland"),
+			postedAt: postedAt,
+			region:   "Queensland",
+			ok:       false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rrp, peakTime, ok := parsePeakToot(tt.toot, tt.postedAt, tt.region, brisbaneLocation)
+			if want, got := tt.ok, ok; want != got {
+				t.Fatalf("Expected %t, got %t", want, got)
+			}
+			if !ok {
+				return
+			}
+			if want, got := tt.rrp, rrp; !FloatEquals(want, got) {
+				t.Errorf("Expected %f, got %f", want, got)
+			}
+			if want, got := tt.peakTime, peakTime; !want.Equal(got) {
+				t.Errorf("Expected %s, got %s", want, got)
+			}
+		})
+	}
+}
+
+func TestRecoverStateFromStatuses(t *testing.T) {
+	cfg := GridBotCfg{}
+	cfg.TestMode = true
+	cfg.RegionID = "QLD1"
+
+	gridBot, err := NewGridBot(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	brisbaneLocation, err := time.LoadLocation("Australia/Brisbane")
+	if err != nil {
+		t.Fatal(err)
+	}
+	postedAt := time.Date(2024, 1, 30, 14, 10, 0, 0, brisbaneLocation)
+	downgrade := fmt.Sprintf(PEAK_DOWNGRADE_TOOT_FORMAT, "Queensland", 1.5, 0.9, "18:00", 0.7, "17:00", "19:00")
+
+	// Newest first, the way Mastodon returns them.
+	statuses := []*mastodon.Status{
+		{Content: "<p>Unrelated toot</p>", CreatedAt: postedAt.Add(time.Hour)},
+		{ID: "2", Content: renderToot(downgrade), CreatedAt: postedAt.Add(30 * time.Minute)},
+		{Content: renderToot(fmt.Sprintf(PEAK_TOOT_FORMAT, "Queensland", 1.5, "17:30", 1.2, "17:00", "18:30")), CreatedAt: postedAt},
+	}
+
+	if !gridBot.recoverStateFromStatuses(statuses) {
+		t.Fatal("Expected to recover state")
+	}
+	ValidateToot(gridBot, 900, time.Date(2024, 1, 30, 18, 0, 0, 0, brisbaneLocation), downgrade, t)
+	// Updates to it carry on the thread.
+	if want, got := "2", gridBot.tootedPeaks[0].StatusIDs["mastodon"]; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+
+	if gridBot.recoverStateFromStatuses(statuses[:1]) {
+		t.Error("Expected not to recover state from an unrelated toot")
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	// Bundle the timezone database so we don't depend on the host having one.
+	_ "time/tzdata"
+)
+
+// AEMO timestamps are in NEM time, which is AEST all year round regardless of
+// where the region is or whether it's on daylight saving.
+var NEMTime = time.FixedZone("AEST", 10*60*60)
+
+// The zone each region's followers live in.
+var regionLocationNames = map[RegionID]string{
+	"QLD1": "Australia/Brisbane",
+	"NSW1": "Australia/Sydney",
+	"VIC1": "Australia/Melbourne",
+	"SA1":  "Australia/Adelaide",
+	"TAS1": "Australia/Hobart",
+}
+
+// Returns the local time zone of a region, including its daylight saving.
+func RegionLocation(regionID RegionID) (*time.Location, error) {
+	name, ok := regionLocationNames[regionID]
+	if !ok {
+		return nil, fmt.Errorf("unknown region ID: %s", regionID)
+	}
+	return time.LoadLocation(name)
+}
+
+// The NEM runs on AEST all year round.
+func inNEMTime(t time.Time) time.Time {
+	return t.In(NEMTime)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// AEMO doesn't observe daylight saving, so settlement dates are +1000 whatever
+// the time of year.
+func TestJSONTimeIsNEMTime(t *testing.T) {
+	for _, s := range []string{"2024-01-30T16:35:00", "2024-07-30T16:35:00"} {
+		var jt JSONTime
+		if err := json.Unmarshal([]byte(`"`+s+`"`), &jt); err != nil {
+			t.Fatal(err)
+		}
+		if want, got := s[:10]+" 16:35:00 +1000 AEST", jt.String(); want != got {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+	}
+}
+
+func TestRegionLocalTime(t *testing.T) {
+	tests := []struct {
+		settlementDate string
+		regionID       RegionID
+		want           string
+	}{
+		// Summer.
+		{"2024-01-30T17:30:00", "QLD1", "17:30 AEST"},
+		{"2024-01-30T17:30:00", "NSW1", "18:30 AEDT"},
+		{"2024-01-30T17:30:00", "VIC1", "18:30 AEDT"},
+		{"2024-01-30T17:30:00", "SA1", "18:00 ACDT"},
+		{"2024-01-30T17:30:00", "TAS1", "18:30 AEDT"},
+		// Daylight saving ends at 3am local time on the 7th of April 2024.
+		{"2024-04-07T01:30:00", "QLD1", "01:30 AEST"},
+		{"2024-04-07T01:30:00", "NSW1", "02:30 AEDT"},
+		{"2024-04-07T01:30:00", "SA1", "02:00 ACDT"},
+		{"2024-04-07T01:30:00", "TAS1", "02:30 AEDT"},
+		{"2024-04-07T02:30:00", "QLD1", "02:30 AEST"},
+		{"2024-04-07T02:30:00", "NSW1", "02:30 AEST"},
+		{"2024-04-07T02:30:00", "VIC1", "02:30 AEST"},
+		{"2024-04-07T02:30:00", "SA1", "02:00 ACST"},
+		// Daylight saving starts at 2am local time on the 6th of October 2024.
+		{"2024-10-06T01:30:00", "NSW1", "01:30 AEST"},
+		{"2024-10-06T01:30:00", "SA1", "01:00 ACST"},
+		{"2024-10-06T02:30:00", "QLD1", "02:30 AEST"},
+		{"2024-10-06T02:30:00", "NSW1", "03:30 AEDT"},
+		{"2024-10-06T02:30:00", "VIC1", "03:30 AEDT"},
+		{"2024-10-06T02:30:00", "SA1", "03:00 ACDT"},
+		{"2024-10-06T02:30:00", "TAS1", "03:30 AEDT"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %s", tt.regionID, tt.settlementDate), func(t *testing.T) {
+			var jt JSONTime
+			if err := json.Unmarshal([]byte(`"`+tt.settlementDate+`"`), &jt); err != nil {
+				t.Fatal(err)
+			}
+			location, err := RegionLocation(tt.regionID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, got := tt.want, jt.In(location).Format("15:04 MST"); want != got {
+				t.Errorf("Expected %s, got %s", want, got)
+			}
+		})
+	}
+
+	if _, err := RegionLocation("WA1"); err == nil {
+		t.Error("Expected an error for an unknown region")
+	}
+}
+
+func TestTootUsesRegionLocalTime(t *testing.T) {
+	gridBot, err := NewGridBot(GridBotCfg{RegionID: "SA1", TestMode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jt JSONTime
+	if err := json.Unmarshal([]byte(`"2024-01-30T17:30:00"`), &jt); err != nil {
+		t.Fatal(err)
+	}
+	gridBot.forecasts = NewForecastRun("SA1", jt.Add(-FORECAST_INTERVAL_LENGTH), 1500)
+	gridBot.forecastsStale = false
+	gridBot.considerPostingToot()
+	if want, got := fmt.Sprintf(PEAK_TOOT_FORMAT, "South Australia", 1.5, "18:00", 1.5, "17:30", "18:00"), gridBot.lastToot; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+// A toot posted just before daylight saving starts can name a peak time after it.
+func TestPeakTimeFromTootAcrossDST(t *testing.T) {
+	sydney, err := RegionLocation("NSW1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	postedAt := time.Date(2024, 10, 6, 1, 50, 0, 0, sydney)
+	peakTime, ok := peakTimeFromToot("03:30", postedAt, sydney)
+	if !ok {
+		t.Fatal("Expected to parse the peak time")
+	}
+	if want, got := time.Date(2024, 10, 5, 16, 30, 0, 0, time.UTC), peakTime; !want.Equal(got) {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const TROUGH_TOOT_FORMAT = "%s wholesale electricity prices are predicted to drop to %s between %s and %s. A good time to charge! " + AEMO_VISUALISATION_URL
+const TROUGH_UPDATE_TOOT_FORMAT = "The %s predicted wholesale electricity price trough has changed. Prices are now predicted to drop to %s between %s and %s: " + AEMO_VISUALISATION_URL
+const TROUGH_CANCELLED_TOOT_FORMAT = "The %s wholesale electricity price trough predicted between %s and %s is no longer forecast: " + AEMO_VISUALISATION_URL
+
+// Finds the run of forecast intervals priced below threshold with the lowest
+// forecast price in it. ok is false if nothing is below threshold.
+func findTrough(forecasts []Interval, threshold float64) (trough PriceWindow, ok bool) {
+	windows := findWindows(forecasts, func(rrp float64) bool { return rrp < threshold }, func(a, b float64) bool { return a < b })
+	for _, w := range windows {
+		if !ok || w.RRP < trough.RRP {
+			trough, ok = w, true
+		}
+	}
+	return trough, ok
+}
+
+// Returns true if trough covers the same time as the one we last tooted about.
+// Once a trough is underway its start moves up with each forecast, which isn't
+// worth tooting about.
+func (gb *GridBot) sameTroughWindow(trough PriceWindow, now time.Time) bool {
+	last := gb.lastTootedTrough
+	if !trough.End.Equal(last.End) {
+		return false
+	}
+	return trough.Start.Equal(last.Start) || (trough.Start.After(last.Start) && !trough.Start.After(now))
+}
+
+// Works like considerPostingToot, but for prices dropping below the trough
+// threshold rather than rising above the peak one.
+func (gb *GridBot) considerPostingTroughToot() {
+	if !gb.cfg.TroughsEnabled {
+		return
+	}
+	// If nothing new came in there's nothing to go on.
+	if gb.forecastsStale {
+		return
+	}
+	now := time.Now()
+	trough, found := findTrough(gb.forecasts, gb.cfg.TroughRRP)
+	if gb.lastTootedTrough.End.Before(now) {
+		// It's been and gone, so there's nothing to update or retract.
+		gb.lastTootedTrough = PriceWindow{}
+	}
+	last := gb.lastTootedTrough
+
+	var toot string
+	event := PeakEvent{
+		RegionID:    gb.cfg.RegionID,
+		RRP:         trough.RRP,
+		PreviousRRP: last.RRP,
+		PeakTime:    trough.RRPTime,
+		AverageRRP:  trough.AverageRRP,
+		WindowStart: &trough.Start,
+		WindowEnd:   &trough.End,
+	}
+	if !found {
+		if last.IsZero() {
+			return
+		}
+		toot = fmt.Sprintf(TROUGH_CANCELLED_TOOT_FORMAT, gb.regionString, gb.clock(last.Start), gb.clock(last.End))
+		event.Type = PeakEventTroughCancelled
+		event.PeakTime = last.RRPTime
+		event.AverageRRP = last.AverageRRP
+		event.WindowStart = &last.Start
+		event.WindowEnd = &last.End
+	} else if last.IsZero() {
+		toot = fmt.Sprintf(TROUGH_TOOT_FORMAT, gb.regionString, Price{RRP: trough.RRP, Units: gb.cfg.Templates.Units}, gb.clock(trough.Start), gb.clock(trough.End))
+		event.Type = PeakEventTrough
+	} else {
+		if gb.alreadyTooted(trough.RRP, last.RRP, gb.sameTroughWindow(trough, now)) {
+			return
+		}
+		toot = fmt.Sprintf(TROUGH_UPDATE_TOOT_FORMAT, gb.regionString, Price{RRP: trough.RRP, Units: gb.cfg.Templates.Units}, gb.clock(trough.Start), gb.clock(trough.End))
+		event.Type = PeakEventTroughUpdate
+	}
+
+	gb.lastTootedTrough = trough
+	gb.postEvent(toot, event, nil, "")
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFindTrough(t *testing.T) {
+	start := time.Date(2024, 10, 20, 9, 0, 0, 0, NEMTime)
+	at := func(n int) time.Time {
+		return start.Add(time.Duration(n) * FORECAST_INTERVAL_LENGTH)
+	}
+	tests := []struct {
+		name   string
+		rrps   []float64
+		ok     bool
+		trough PriceWindow
+	}{
+		{"none", []float64{50, 20, 10, 30}, false, PriceWindow{}},
+		{"one interval", []float64{50, -5, 10, 30}, true, PriceWindow{Start: at(1), End: at(2), RRP: -5, RRPTime: at(2)}},
+		{"window", []float64{50, -5, -40, -10, 30}, true, PriceWindow{Start: at(1), End: at(4), RRP: -40, RRPTime: at(3)}},
+		{"runs to the end", []float64{50, -5, -40}, true, PriceWindow{Start: at(1), End: at(3), RRP: -40, RRPTime: at(3)}},
+		// Only the run with the lowest price counts.
+		{"two windows", []float64{-5, 20, -10, -30, 20}, true, PriceWindow{Start: at(2), End: at(4), RRP: -30, RRPTime: at(4)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forecasts := NewForecastRun("SA1", start, tt.rrps...)
+			// Order shouldn't matter.
+			forecasts[0], forecasts[len(forecasts)-1] = forecasts[len(forecasts)-1], forecasts[0]
+			trough, ok := findTrough(forecasts, 0)
+			if want, got := tt.ok, ok; want != got {
+				t.Fatalf("Expected %t, got %t", want, got)
+			}
+			if !tt.trough.Start.Equal(trough.Start) || !tt.trough.End.Equal(trough.End) || !tt.trough.RRPTime.Equal(trough.RRPTime) || !FloatEquals(tt.trough.RRP, trough.RRP) {
+				t.Errorf("Expected %+v, got %+v", tt.trough, trough)
+			}
+		})
+	}
+}
+
+func TestGridBotTroughToots(t *testing.T) {
+	gridBot, err := NewGridBot(GridBotCfg{RegionID: "SA1", TestMode: true, TroughsEnabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := newFakeEventNotifier()
+	gridBot.notifiers = []Notifier{events}
+
+	start := time.Now().Add(time.Hour).Truncate(FORECAST_INTERVAL_LENGTH)
+	clock := func(n int) string {
+		return gridBot.clock(start.Add(time.Duration(n) * FORECAST_INTERVAL_LENGTH))
+	}
+	for _, step := range []struct {
+		rrps  []float64
+		toot  string // Blank if it shouldn't toot.
+		event PeakEventType
+	}{
+		{[]float64{50, 20, 10}, "", ""},
+		{[]float64{50, -20, -60, 10}, fmt.Sprintf(TROUGH_TOOT_FORMAT, "South Australia", "-$0.06/kWh", clock(1), clock(3)), PeakEventTrough},
+		// Not a big enough change to bother anyone with.
+		{[]float64{50, -20, -80, 10}, "", ""},
+		{[]float64{50, -20, -150, 10}, fmt.Sprintf(TROUGH_UPDATE_TOOT_FORMAT, "South Australia", Price{RRP: -150}, clock(1), clock(3)), PeakEventTroughUpdate},
+		// The window getting longer is worth a toot even if the price isn't.
+		{[]float64{50, -20, -150, -10}, fmt.Sprintf(TROUGH_UPDATE_TOOT_FORMAT, "South Australia", Price{RRP: -150}, clock(1), clock(4)), PeakEventTroughUpdate},
+		{[]float64{50, 20, 10, 10}, fmt.Sprintf(TROUGH_CANCELLED_TOOT_FORMAT, "South Australia", clock(1), clock(4)), PeakEventTroughCancelled},
+		{[]float64{50, 20, 10, 10}, "", ""},
+	} {
+		gridBot.lastToot = ""
+		gridBot.forecasts = NewForecastRun("SA1", start, step.rrps...)
+		gridBot.forecastsStale = false
+		gridBot.considerPostingTroughToot()
+		if want, got := step.toot, gridBot.lastToot; want != got {
+			t.Errorf("For %v expected %q, got %q", step.rrps, want, got)
+		}
+		if step.event == "" {
+			continue
+		}
+		e := events.waitForEvent(t)
+		if want, got := step.event, e.Type; want != got {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+		if e.WindowStart == nil || e.WindowEnd == nil {
+			t.Errorf("Expected the event to have a window")
+		}
+	}
+}
+
+// Troughs are opt-in, so by default a trough isn't tooted about.
+func TestGridBotTroughsDisabled(t *testing.T) {
+	gridBot, err := NewGridBot(GridBotCfg{RegionID: "SA1", TestMode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gridBot.forecasts = NewForecastRun("SA1", time.Now().Add(time.Hour), 50, -20, -60, 10)
+	gridBot.forecastsStale = false
+	gridBot.considerPostingTroughToot()
+	if want, got := "", gridBot.lastToot; want != got {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+// A trough that's come and gone doesn't need cancelling, and the next one is new.
+func TestGridBotTroughPassed(t *testing.T) {
+	gridBot, err := NewGridBot(GridBotCfg{RegionID: "SA1", TestMode: true, TroughsEnabled: true, TroughRRP: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-3 * time.Hour)
+	gridBot.lastTootedTrough = PriceWindow{Start: past, End: past.Add(time.Hour), RRP: 5, RRPTime: past.Add(time.Hour)}
+
+	start := time.Now().Add(time.Hour).Truncate(FORECAST_INTERVAL_LENGTH)
+	gridBot.forecasts = NewForecastRun("SA1", start, 50, 30, 30)
+	gridBot.forecastsStale = false
+	gridBot.considerPostingTroughToot()
+	if gridBot.lastToot != "" {
+		t.Errorf("Expected no toot, got %q", gridBot.lastToot)
+	}
+
+	gridBot.lastTootedTrough = PriceWindow{Start: past, End: past.Add(time.Hour), RRP: 5, RRPTime: past.Add(time.Hour)}
+	gridBot.forecasts = NewForecastRun("SA1", start, 50, 15, 30)
+	gridBot.considerPostingTroughToot()
+	clock := func(n int) string {
+		return gridBot.clock(start.Add(time.Duration(n) * FORECAST_INTERVAL_LENGTH))
+	}
+	if want, got := fmt.Sprintf(TROUGH_TOOT_FORMAT, "South Australia", Price{RRP: 15}, clock(1), clock(2)), gridBot.lastToot; want != got {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
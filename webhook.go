@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const WEBHOOK_SIGNATURE_HEADER = "X-Gridbot-Signature"
+const WEBHOOK_TIMESTAMP_HEADER = "X-Gridbot-Timestamp"
+const WEBHOOK_ATTEMPTS = 5
+
+// How long to keep trying a webhook for, all up. Toots are sent from the
+// GridBot's main loop, so a slow endpoint mustn't hold it up for long.
+const WEBHOOK_RETRY_TIME = 30 * time.Second
+
+// A plain text post, rather than a PeakEvent, is sent with this type.
+const WEBHOOK_MESSAGE_TYPE = "message"
+
+// Webhook POSTs PeakEvents as JSON to a URL, signed with a shared secret.
+type Webhook struct {
+	url       string
+	secret    string
+	client    *http.Client
+	backoff   time.Duration // How long to wait before the first retry. Doubles each time.
+	retryTime time.Duration // How long to keep trying for, including the requests themselves.
+}
+
+func NewWebhook(url, secret string) *Webhook {
+	return &Webhook{
+		url:       url,
+		secret:    secret,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		backoff:   1 * time.Second,
+		retryTime: WEBHOOK_RETRY_TIME,
+	}
+}
+
+func (w *Webhook) Name() string {
+	return "webhook"
+}
+
+// Signs the timestamp and body, so a receiver can check both that the payload
+// came from us and that it isn't an old one being replayed.
+func SignWebhookPayload(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (w *Webhook) send(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WEBHOOK_TIMESTAMP_HEADER, timestamp)
+	if w.secret != "" {
+		req.Header.Set(WEBHOOK_SIGNATURE_HEADER, SignWebhookPayload(w.secret, timestamp, body))
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return webhookStatusError(resp.StatusCode)
+	}
+	return nil
+}
+
+type webhookStatusError int
+
+func (e webhookStatusError) Error() string {
+	return fmt.Sprintf("got status code %d", int(e))
+}
+
+// Errors talking to the server and server-side errors are worth retrying, but
+// if the endpoint has rejected the payload it'll just reject it again.
+func webhookRetryable(err error) bool {
+	if code, ok := err.(webhookStatusError); ok {
+		return code >= 500 || code == http.StatusTooManyRequests || code == http.StatusRequestTimeout
+	}
+	return true
+}
+
+// Sends the payload, retrying with exponential backoff if it fails, for up to
+// retryTime all up.
+func (w *Webhook) post(payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), w.retryTime)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+	backoff := w.backoff
+	for attempt := 1; ; attempt++ {
+		if err = w.send(ctx, body); err == nil {
+			return nil
+		}
+		if attempt == WEBHOOK_ATTEMPTS || !webhookRetryable(err) || time.Until(deadline) < backoff {
+			return fmt.Errorf("giving up after %d attempts: %s", attempt, err)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (w *Webhook) NotifyEvent(e PeakEvent, image []byte) error {
+	return w.post(e)
+}
+
+func (w *Webhook) PostStatus(status string) error {
+	return w.post(map[string]string{
+		"type":    WEBHOOK_MESSAGE_TYPE,
+		"message": status,
+	})
+}
+
+func (w *Webhook) PostStatusWithImageFromReader(status string, file io.Reader, altText string, visibility string) (string, error) {
+	return "", w.PostStatus(status)
+}
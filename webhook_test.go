@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookRetriesAndSigns(t *testing.T) {
+	attempts := 0
+	var got PeakEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		timestamp := r.Header.Get(WEBHOOK_TIMESTAMP_HEADER)
+		if want, got := SignWebhookPayload("secret", timestamp, body), r.Header.Get(WEBHOOK_SIGNATURE_HEADER); want != got {
+			t.Errorf("Expected signature %s, got %s", want, got)
+		}
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+
+	w := NewWebhook(server.URL, "secret")
+	w.backoff = time.Millisecond
+
+	peakTime := time.Date(2024, 1, 30, 17, 30, 0, 0, time.UTC)
+	event := PeakEvent{
+		Type:     PeakEventPeak,
+		RegionID: "QLD1",
+		RRP:      1500,
+		PeakTime: peakTime,
+		Forecast: []ForecastPoint{{Time: peakTime, RRP: 1500}},
+	}
+	if err := w.NotifyEvent(event, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 3, attempts; want != got {
+		t.Errorf("Expected %d attempts, got %d", want, got)
+	}
+	if want, got := PeakEventPeak, got.Type; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if want, got := RegionID("QLD1"), got.RegionID; want != got {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if want, got := peakTime, got.PeakTime; !want.Equal(got) {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if want, got := 1, len(got.Forecast); want != got {
+		t.Errorf("Expected %d, got %d", want, got)
+	}
+}
+
+func TestWebhookDoesNotRetryRejections(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	w := NewWebhook(server.URL, "secret")
+	w.backoff = time.Millisecond
+	if err := w.PostStatus("hello"); err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	if want, got := 1, attempts; want != got {
+		t.Errorf("Expected %d attempts, got %d", want, got)
+	}
+}
+
+func TestWebhookGivesUpInTime(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	w := NewWebhook(server.URL, "secret")
+	// Time for the first retry, but not the second.
+	w.backoff = 50 * time.Millisecond
+	w.retryTime = 120 * time.Millisecond
+	start := time.Now()
+	if err := w.PostStatus("hello"); err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	if want, got := 2, attempts; want != got {
+		t.Errorf("Expected %d attempts, got %d", want, got)
+	}
+	if elapsed := time.Since(start); elapsed > w.retryTime {
+		t.Errorf("Expected to give up within %s, took %s", w.retryTime, elapsed)
+	}
+}
+
+func TestGridBotSendsWebhookEvents(t *testing.T) {
+	events := make(chan PeakEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e PeakEvent
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Error(err)
+		}
+		events <- e
+	}))
+	defer server.Close()
+
+	cfg := GridBotCfg{}
+	cfg.TestMode = true
+	cfg.RegionID = "QLD1"
+
+	gridBot, err := NewGridBot(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gridBot.AddNotifier(NewWebhook(server.URL, "secret"))
+	go gridBot.Mainloop()
+
+	peakTime := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+	peakRRP := float64(INTERESTING_PEAK_RRP * 3)
+	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP/2, peakTime.Add(-FORECAST_INTERVAL_LENGTH), t)
+	gridBot.GetIntervalChannel() <- NewForecastInterval(gridBot, peakRRP, peakTime, t)
+	close(gridBot.GetIntervalChannel())
+
+	select {
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for webhook")
+	case e := <-events:
+		if want, got := PeakEventPeak, e.Type; want != got {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+		if want, got := peakRRP, e.RRP; !FloatEquals(want, got) {
+			t.Errorf("Expected %f, got %f", want, got)
+		}
+		if want, got := peakTime, e.PeakTime; !want.Equal(got) {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+		if want, got := 2, len(e.Forecast); want != got {
+			t.Errorf("Expected %d, got %d", want, got)
+		}
+		window := PriceWindow{Start: peakTime.Add(-2 * FORECAST_INTERVAL_LENGTH), End: peakTime, AverageRRP: peakRRP * 3 / 4}
+		if want, got := FormatExpectedToot(peakRRP, peakTime, "Queensland", 0, PEAK, window), e.Message; want != got {
+			t.Errorf("Expected %s, got %s", want, got)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// AEMO forecasts in half hour intervals. Each interval's settlement date is the
+// end of it.
+const FORECAST_INTERVAL_LENGTH = 30 * time.Minute
+
+// PriceWindow is a run of consecutive forecast intervals, like a peak or a trough.
+type PriceWindow struct {
+	Start      time.Time `json:"Start"`
+	End        time.Time `json:"End"`
+	RRP        float64   `json:"RRP"`     // The highest price in a peak, or the lowest in a trough.
+	RRPTime    time.Time `json:"RRPTime"` // When RRP is.
+	AverageRRP float64   `json:"AverageRRP"`
+}
+
+func (w PriceWindow) IsZero() bool {
+	return w.End.IsZero()
+}
+
+func (w PriceWindow) Overlaps(o PriceWindow) bool {
+	return w.Start.Before(o.End) && o.Start.Before(w.End)
+}
+
+// Splits the forecasts up into windows of consecutive intervals that inWindow is
+// true for, in time order. A gap in the forecasts ends a window, since we've no
+// idea what prices are in it. Each window's RRP is the one that better prefers.
+func findWindows(forecasts []Interval, inWindow func(rrp float64) bool, better func(a, b float64) bool) []PriceWindow {
+	sorted := make([]Interval, len(forecasts))
+	copy(sorted, forecasts)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].SettlementDate.Before(sorted[j].SettlementDate.Time)
+	})
+
+	windows := []PriceWindow{}
+	var w PriceWindow
+	var count int
+	for n, i := range sorted {
+		if !inWindow(i.RRP) {
+			continue
+		}
+		if count == 0 {
+			w = PriceWindow{Start: i.SettlementDate.Add(-FORECAST_INTERVAL_LENGTH), RRP: i.RRP, RRPTime: i.SettlementDate.Time}
+		} else if better(i.RRP, w.RRP) {
+			w.RRP = i.RRP
+			w.RRPTime = i.SettlementDate.Time
+		}
+		w.End = i.SettlementDate.Time
+		w.AverageRRP += i.RRP
+		count++
+		if n == len(sorted)-1 || !inWindow(sorted[n+1].RRP) || sorted[n+1].SettlementDate.Sub(i.SettlementDate.Time) > FORECAST_INTERVAL_LENGTH {
+			w.AverageRRP /= float64(count)
+			windows = append(windows, w)
+			count = 0
+		}
+	}
+	return windows
+}
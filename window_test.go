@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// A missing interval splits a window in two, rather than the window running
+// straight over a stretch of time we've no forecast for.
+func TestFindWindowsSplitsOnGaps(t *testing.T) {
+	start := time.Date(2024, 10, 20, 16, 0, 0, 0, NEMTime)
+	at := func(n int) time.Time {
+		return start.Add(time.Duration(n) * FORECAST_INTERVAL_LENGTH)
+	}
+	forecasts := NewForecastRun("SA1", start, 700, 800, 900, 600)
+	forecasts = append(forecasts[:2], forecasts[3:]...)
+
+	windows := findWindows(forecasts, func(rrp float64) bool { return rrp > 500 }, func(a, b float64) bool { return a > b })
+	expected := []PriceWindow{
+		{Start: at(0), End: at(2), RRP: 800, RRPTime: at(2), AverageRRP: 750},
+		{Start: at(3), End: at(4), RRP: 600, RRPTime: at(4), AverageRRP: 600},
+	}
+	if want, got := len(expected), len(windows); want != got {
+		t.Fatalf("Expected %d windows, got %d: %+v", want, got, windows)
+	}
+	for n, want := range expected {
+		got := windows[n]
+		if !want.Start.Equal(got.Start) || !want.End.Equal(got.End) || !want.RRPTime.Equal(got.RRPTime) || !FloatEquals(want.RRP, got.RRP) || !FloatEquals(want.AverageRRP, got.AverageRRP) {
+			t.Errorf("Expected %+v, got %+v", want, got)
+		}
+	}
+}